@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"metrics/internal/compress"
+	"metrics/internal/security"
+)
+
+var ErrStatus = errors.New("unexpected status")
+
+// api HTTP-клиент сервера: тела запросов сжимаются и подписываются, как у агента.
+type api struct {
+	client *http.Client
+	base   string
+	key    string
+}
+
+func newAPI(addr, key string, timeout time.Duration) *api {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	return &api{
+		client: &http.Client{Timeout: timeout},
+		base:   strings.TrimSuffix(addr, "/"),
+		key:    key,
+	}
+}
+
+func (a *api) do(method, path string, data []byte) ([]byte, error) {
+	var body io.Reader = http.NoBody
+	if data != nil {
+		compressed, err := compress.Compress(data)
+		if err != nil {
+			return nil, fmt.Errorf("compress: %w", err)
+		}
+		body = bytes.NewReader(compressed)
+	}
+	req, err := http.NewRequest(method, a.base+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Content-Encoding", "gzip")
+		if a.key != "" {
+			req.Header.Set("HashSHA256", security.Hash(&data, a.key))
+		}
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w %d: %s", ErrStatus, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	return respBody, nil
+}
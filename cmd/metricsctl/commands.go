@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+
+	s "metrics/internal/service"
+
+	"github.com/pquerna/ffjson/ffjson"
+)
+
+const importBatch = 1000
+
+var errUsage = errors.New("invalid arguments")
+
+func (c *cli) run(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	cmd, args := args[0], args[1:]
+	switch {
+	case cmd == "get" && len(args) == 2:
+		return c.get(args[0], args[1])
+	case cmd == "list" && len(args) == 0:
+		return c.list()
+	case cmd == "push" && len(args) == 3:
+		return c.push(args[0], args[1], args[2])
+	case cmd == "import" && len(args) <= 1:
+		return c.importMetrics(fileArg(args))
+	case cmd == "export" && len(args) <= 1:
+		return c.export(fileArg(args))
+	case cmd == "ping" && len(args) == 0:
+		return c.ping()
+	}
+	return errUsage
+}
+
+func fileArg(args []string) string {
+	if len(args) == 0 {
+		return "-"
+	}
+	return args[0]
+}
+
+func (c *cli) metricLabels() (map[string]string, error) {
+	if c.labels == "" {
+		return nil, nil
+	}
+	labels, err := s.ParseLabels(c.labels)
+	if err != nil {
+		return nil, fmt.Errorf("labels: %w", err)
+	}
+	return labels, nil
+}
+
+func (c *cli) get(mtype, id string) error {
+	labels, err := c.metricLabels()
+	if err != nil {
+		return err
+	}
+	data, _ := ffjson.Marshal(&s.Metrics{ID: id, MType: mtype, Labels: labels})
+	resp, err := c.api.do(http.MethodPost, "/value/", data)
+	if err != nil {
+		return err
+	}
+	met := &s.Metrics{}
+	if err = met.UnmarshalJSON(resp); err != nil {
+		return fmt.Errorf("decode metric: %w", err)
+	}
+	return render(c.out, c.format, []*s.Metrics{met})
+}
+
+func (c *cli) fetchAll() ([]*s.Metrics, error) {
+	resp, err := c.api.do(http.MethodGet, "/values/", nil)
+	if err != nil {
+		return nil, err
+	}
+	var metrics []*s.Metrics
+	if err = ffjson.Unmarshal(resp, &metrics); err != nil {
+		return nil, fmt.Errorf("decode metrics: %w", err)
+	}
+	return metrics, nil
+}
+
+func (c *cli) list() error {
+	metrics, err := c.fetchAll()
+	if err != nil {
+		return err
+	}
+	return render(c.out, c.format, metrics)
+}
+
+func (c *cli) push(mtype, id, val string) error {
+	met, err := s.NewMetric(mtype, id, val)
+	if err != nil {
+		return fmt.Errorf("metric: %w", err)
+	}
+	if met.Labels, err = c.metricLabels(); err != nil {
+		return err
+	}
+	data, _ := met.MarshalJSON()
+	resp, err := c.api.do(http.MethodPost, "/update/", data)
+	if err != nil {
+		return err
+	}
+	if err = met.UnmarshalJSON(resp); err != nil {
+		return fmt.Errorf("decode metric: %w", err)
+	}
+	return render(c.out, c.format, []*s.Metrics{met})
+}
+
+// importMetrics отправляет метрики пакетами. Сервер прибавляет counter
+// и histogram к текущим значениям, поэтому повторный импорт выгрузки
+// удвоил бы их: без -force они пропускаются.
+func (c *cli) importMetrics(path string) error {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return fmt.Errorf("read metrics: %w", err)
+	}
+	var metrics []*s.Metrics
+	if err = ffjson.Unmarshal(data, &metrics); err != nil {
+		return fmt.Errorf("decode metrics: %w", err)
+	}
+	skipped := 0
+	if !c.force {
+		metrics = slices.DeleteFunc(metrics, func(met *s.Metrics) bool {
+			cumulative := met != nil && (met.IsCounter() || met.IsHistogram())
+			if cumulative {
+				skipped++
+			}
+			return cumulative
+		})
+	}
+	for start := 0; start < len(metrics); start += importBatch {
+		batch := metrics[start:min(start+importBatch, len(metrics))]
+		data, _ = ffjson.Marshal(batch)
+		if _, err = c.api.do(http.MethodPost, "/updates/", data); err != nil {
+			return fmt.Errorf("import after %d metrics: %w", start, err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "imported %d metrics\n", len(metrics))
+	if skipped > 0 {
+		fmt.Fprintf(os.Stderr, "skipped %d counters and histograms, use -force to add them\n", skipped)
+	}
+	return nil
+}
+
+func (c *cli) export(path string) error {
+	metrics, err := c.fetchAll()
+	if err != nil {
+		return err
+	}
+	out := c.out
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("export: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	return render(out, formatJSON, metrics)
+}
+
+func (c *cli) ping() error {
+	if _, err := c.api.do(http.MethodGet, "/ping", nil); err != nil {
+		return err
+	}
+	fmt.Fprintln(c.out, "ok")
+	return nil
+}
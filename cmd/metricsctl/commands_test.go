@@ -0,0 +1,50 @@
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	s "metrics/internal/service"
+
+	"github.com/pquerna/ffjson/ffjson"
+)
+
+func TestImportSkipsCounters(t *testing.T) {
+	var got [][]*s.Metrics
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var batch []*s.Metrics
+		if err = ffjson.NewDecoder().DecodeReader(zr, &batch); err != nil {
+			t.Error(err)
+		}
+		got = append(got, batch)
+	}))
+	defer srv.Close()
+
+	file := filepath.Join(t.TempDir(), "export.json")
+	_ = os.WriteFile(file, []byte(`[{"id":"CPU","type":"gauge","value":1.5},
+		{"id":"Hits","type":"counter","delta":5}]`), 0o600)
+
+	c := &cli{api: newAPI(srv.URL, "", time.Second)}
+	if err := c.importMetrics(file); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || len(got[0]) != 1 || got[0][0].ID != "CPU" {
+		t.Errorf("expected only the gauge without -force, got %v", got)
+	}
+	got, c.force = nil, true
+	if err := c.importMetrics(file); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || len(got[0]) != 2 {
+		t.Errorf("expected gauge and counter with -force, got %v", got)
+	}
+}
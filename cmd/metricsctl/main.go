@@ -0,0 +1,64 @@
+// metricsctl — утилита оператора сервера метрик.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const usage = `Usage: metricsctl [flags] <command> [args]
+
+Commands:
+  get <type> <id>            value of one metric (POST /value/)
+  list                       all metrics (GET /values/)
+  push <type> <id> <value>   update one metric (POST /update/)
+  import [file|-]            send a JSON array of metrics (POST /updates/);
+                             counters and histograms are added to the server
+                             values, so they are skipped unless -force is set
+  export [file|-]            save all metrics as a JSON array
+  ping                       check server storage (GET /ping)
+
+Flags:
+`
+
+type cli struct {
+	api    *api
+	out    io.Writer
+	format string
+	labels string
+	force  bool
+}
+
+func main() {
+	flags := flag.NewFlagSet("metricsctl", flag.ExitOnError)
+	addr := flags.String("a", "localhost:8080", "Server address arg: -a <host:port|URL>")
+	key := flags.String("k", os.Getenv("KEY"), "Sign key arg: -k <keystring>")
+	format := flags.String("o", formatTable, "Output format arg: -o <table|json|csv>")
+	labels := flags.String("l", "", "Metric labels arg: -l <k=v,k2=v2>")
+	timeout := flags.Duration("t", 10*time.Second, "Request timeout arg: -t <duration>")
+	force := flags.Bool("force", false, "Import counters and histograms too: they add to server values")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(os.Args[1:])
+
+	c := &cli{
+		api:    newAPI(*addr, *key, *timeout),
+		out:    os.Stdout,
+		format: *format,
+		labels: *labels,
+		force:  *force,
+	}
+	if err := c.run(flags.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "metricsctl:", err)
+		if errors.Is(err, errUsage) {
+			flags.Usage()
+		}
+		os.Exit(1)
+	}
+}
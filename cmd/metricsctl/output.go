@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	s "metrics/internal/service"
+)
+
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatCSV   = "csv"
+)
+
+func render(w io.Writer, format string, metrics []*s.Metrics) error {
+	switch format {
+	case formatTable:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "TYPE\tID\tLABELS\tVALUE")
+		for _, met := range metrics {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", met.MType, met.ID, met.LabelString(), valueString(met))
+		}
+		return tw.Flush()
+	case formatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(metrics); err != nil {
+			return fmt.Errorf("encode json: %w", err)
+		}
+		return nil
+	case formatCSV:
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{"type", "id", "labels", "value"})
+		for _, met := range metrics {
+			_ = cw.Write([]string{met.MType, met.ID, met.LabelString(), valueString(met)})
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return fmt.Errorf("write csv: %w", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q", format)
+}
+
+func valueString(met *s.Metrics) string {
+	switch {
+	case met.Hist != nil:
+		return fmt.Sprintf("count=%d sum=%g", met.Hist.Count, met.Hist.Sum)
+	case met.Delta != nil:
+		return strconv.FormatInt(*met.Delta, 10)
+	case met.Value != nil:
+		return strconv.FormatFloat(*met.Value, 'g', -1, 64)
+	}
+	return ""
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	s "metrics/internal/service"
+)
+
+func TestRender(t *testing.T) {
+	gauge := s.BuildMetric("CPU", 12.5)
+	gauge.Labels = map[string]string{"cpu": "1"}
+	metrics := []*s.Metrics{gauge, s.BuildMetric("Hits", int64(5))}
+
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{formatTable, []string{"TYPE", `gauge    CPU   {cpu="1"}  12.5`, "counter  Hits"}},
+		{formatCSV, []string{"type,id,labels,value", `gauge,CPU,"{cpu=""1""}",12.5`, "counter,Hits,,5"}},
+		{formatJSON, []string{`"id": "CPU"`, `"delta": 5`}},
+	}
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			if err := render(buf, test.format, metrics); err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range test.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("expected %q in output:\n%s", want, buf)
+				}
+			}
+		})
+	}
+	if err := render(&bytes.Buffer{}, "yaml", metrics); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
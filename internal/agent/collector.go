@@ -0,0 +1,160 @@
+package agent
+
+import (
+	ctx "context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"metrics/internal/logger"
+	s "metrics/internal/service"
+
+	"go.uber.org/zap"
+)
+
+// Collector источник метрик агента. Сборщики регистрируются в SelfMonitor
+// и опрашиваются каждый в своей горутине со своим интервалом.
+// Counter возвращает приращение за один сбор: приращения копятся до отправки отчета.
+type Collector interface {
+	Name() string
+	Collect(ctx.Context) ([]*s.Metrics, error)
+}
+
+// minCollectTimeout нижняя граница тайм-аута сбора: ps измеряет CPU за секунду.
+const minCollectTimeout = 5 * time.Second
+
+var (
+	ErrDuplicateCollector = errors.New("collector is already registered")
+	ErrCollectorPanic     = errors.New("collector panic")
+)
+
+type registered struct {
+	Collector
+	interval time.Duration // 0 — PollInterval
+}
+
+// Register добавляет сборщик до запуска Run. Метрики сборщиков
+// попадают в отчет в порядке регистрации.
+func (sm *SelfMonitor) Register(c Collector, interval time.Duration) error {
+	for _, rc := range sm.collectors {
+		if rc.Name() == c.Name() {
+			return fmt.Errorf("%w: %s", ErrDuplicateCollector, c.Name())
+		}
+	}
+	sm.collectors = append(sm.collectors, registered{Collector: c, interval: interval})
+	return nil
+}
+
+// SetInterval меняет интервал зарегистрированного сборщика до запуска Run.
+// false — сборщик с таким именем не зарегистрирован.
+func (sm *SelfMonitor) SetInterval(name string, interval time.Duration) bool {
+	for i := range sm.collectors {
+		if sm.collectors[i].Name() == name {
+			sm.collectors[i].interval = interval
+			return true
+		}
+	}
+	return false
+}
+
+// runCollector опрашивает сборщик по его интервалу. Ошибка или паника
+// сборщика не затрагивает остальные: в отчете остается прошлый результат.
+func (sm *SelfMonitor) runCollector(cx ctx.Context, wg *sync.WaitGroup, rc registered) {
+	defer wg.Done()
+	interval := rc.interval
+	if interval <= 0 {
+		interval = sm.PollInterval
+	}
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			collectCtx, cancel := ctx.WithTimeout(cx, max(interval, minCollectTimeout))
+			metrics, err := safeCollect(collectCtx, rc)
+			cancel()
+			if err != nil {
+				logger.Warn("collector error", zap.String("collector", rc.Name()), zap.Error(err))
+			}
+			if len(metrics) > 0 || err == nil {
+				sm.mtx.Lock()
+				sm.store(rc.Name(), metrics)
+				sm.mtx.Unlock()
+			}
+		case <-cx.Done():
+			logger.Debug("goodbye from collector", zap.String("collector", rc.Name()))
+			return
+		}
+	}
+}
+
+func safeCollect(cx ctx.Context, c Collector) (metrics []*s.Metrics, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			metrics, err = nil, fmt.Errorf("%w: %v", ErrCollectorPanic, r)
+		}
+	}()
+	return c.Collect(cx)
+}
+
+// Методы ниже вызываются под sm.mtx.
+
+// snapshot текущие метрики для отчета.
+func (sm *SelfMonitor) snapshot() []*s.Metrics {
+	var metrics []*s.Metrics
+	for _, rc := range sm.collectors {
+		metrics = append(metrics, sm.results[rc.Name()]...)
+	}
+	return slices.DeleteFunc(metrics, func(met *s.Metrics) bool { return met == nil })
+}
+
+// store сохраняет результат сборщика. Приращения счетчиков копятся
+// до отправки отчета.
+func (sm *SelfMonitor) store(name string, metrics []*s.Metrics) {
+	pending := make(map[string]int64)
+	for _, met := range sm.results[name] {
+		if met != nil && met.IsCounter() && met.Delta != nil {
+			pending[met.Key()] = *met.Delta
+		}
+	}
+	for _, met := range metrics {
+		if met != nil && met.IsCounter() && met.Delta != nil {
+			*met.Delta += pending[met.Key()]
+		}
+	}
+	sm.results[name] = metrics
+}
+
+// sentCounters приращения счетчиков, вошедшие в отчет: сборщик → ключ → приращение.
+type sentCounters map[string]map[string]int64
+
+// pendingCounters приращения счетчиков на момент формирования отчета.
+func (sm *SelfMonitor) pendingCounters() sentCounters {
+	sent := make(sentCounters, len(sm.results))
+	for name, metrics := range sm.results {
+		for _, met := range metrics {
+			if met == nil || !met.IsCounter() || met.Delta == nil || *met.Delta == 0 {
+				continue
+			}
+			if sent[name] == nil {
+				sent[name] = make(map[string]int64)
+			}
+			sent[name][met.Key()] = *met.Delta
+		}
+	}
+	return sent
+}
+
+// deductCounters вычитает отправленные приращения. Собранное после
+// формирования отчета остается до следующего.
+func (sm *SelfMonitor) deductCounters(sent sentCounters) {
+	for name, deltas := range sent {
+		for _, met := range sm.results[name] {
+			if met != nil && met.IsCounter() && met.Delta != nil {
+				*met.Delta -= deltas[met.Key()]
+			}
+		}
+	}
+}
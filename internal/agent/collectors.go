@@ -0,0 +1,302 @@
+package agent
+
+import (
+	ctx "context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	s "metrics/internal/service"
+
+	"github.com/shirou/gopsutil/v4/cpu"
+	"github.com/shirou/gopsutil/v4/disk"
+	"github.com/shirou/gopsutil/v4/host"
+	"github.com/shirou/gopsutil/v4/load"
+	"github.com/shirou/gopsutil/v4/mem"
+	"github.com/shirou/gopsutil/v4/net"
+)
+
+// Имена встроенных сборщиков.
+const (
+	CollectRuntime = "runtime"
+	CollectPs      = "ps"
+	CollectDisk    = "disk"
+	CollectNet     = "net"
+	CollectLoad    = "load"
+	CollectUptime  = "uptime"
+	CollectFD      = "fd"
+)
+
+var ErrUnknownCollector = errors.New("unknown collector")
+
+// NewCollector встроенный сборщик по имени. runtime и ps регистрирует
+// NewSelfMonitor, в конфигурации для них задается только интервал;
+// остальные включаются в конфигурации.
+func NewCollector(name string) (Collector, error) {
+	switch name {
+	case CollectRuntime:
+		return &runtimeCollector{}, nil
+	case CollectPs:
+		return psCollector{}, nil
+	case CollectDisk:
+		return &diskCollector{io: deltas{}}, nil
+	case CollectNet:
+		return &netCollector{io: deltas{}}, nil
+	case CollectLoad:
+		return loadCollector{}, nil
+	case CollectUptime:
+		return uptimeCollector{}, nil
+	case CollectFD:
+		return fdCollector{}, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownCollector, name)
+}
+
+// CollectorSpec сборщик из конфигурации и его интервал (0 — PollInterval).
+type CollectorSpec struct {
+	Name     string
+	Interval time.Duration
+}
+
+// ParseCollectors разбирает список вида "disk:30s,net,load:5s".
+func ParseCollectors(list string) ([]CollectorSpec, error) {
+	var specs []CollectorSpec
+	for _, item := range strings.Split(list, ",") {
+		name, interval, hasInterval := strings.Cut(strings.TrimSpace(item), ":")
+		if name == "" {
+			continue
+		}
+		if _, err := NewCollector(name); err != nil {
+			return nil, err
+		}
+		spec := CollectorSpec{Name: name}
+		if hasInterval {
+			d, err := time.ParseDuration(interval)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("collector %s: invalid interval %q", name, interval)
+			}
+			spec.Interval = d
+		}
+		if slices.ContainsFunc(specs, func(sp CollectorSpec) bool { return sp.Name == name }) {
+			continue
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// deltas переводит накопительные счетчики ОС в приращения counter.
+// Первое наблюдение только запоминается.
+type deltas map[string]uint64
+
+func (d deltas) counter(id string, labels map[string]string, total uint64) *s.Metrics {
+	met := s.BuildMetric(id, int64(0))
+	met.Labels = labels
+	key := met.Key()
+	if prev, ok := d[key]; ok && total >= prev {
+		*met.Delta = int64(total - prev)
+	}
+	d[key] = total
+	return met
+}
+
+func gauge(id string, labels map[string]string, val float64) *s.Metrics {
+	met := s.BuildMetric(id, val)
+	met.Labels = labels
+	return met
+}
+
+// runtimeCollector статистика памяти Go, RandomValue и PollCount.
+type runtimeCollector struct {
+	memStats runtime.MemStats
+}
+
+func (*runtimeCollector) Name() string { return CollectRuntime }
+
+func (rc *runtimeCollector) Collect(ctx.Context) ([]*s.Metrics, error) {
+	ms := &rc.memStats
+	runtime.ReadMemStats(ms)
+	return []*s.Metrics{
+		s.BuildMetric("Alloc", float64(ms.Alloc)),
+		s.BuildMetric("BuckHashSys", float64(ms.BuckHashSys)),
+		s.BuildMetric("Frees", float64(ms.Frees)),
+		s.BuildMetric("GCCPUFraction", ms.GCCPUFraction),
+		s.BuildMetric("GCSys", float64(ms.GCSys)),
+		s.BuildMetric("HeapAlloc", float64(ms.HeapAlloc)),
+		s.BuildMetric("HeapIdle", float64(ms.HeapIdle)),
+		s.BuildMetric("HeapInuse", float64(ms.HeapInuse)),
+		s.BuildMetric("HeapObjects", float64(ms.HeapObjects)),
+		s.BuildMetric("HeapReleased", float64(ms.HeapReleased)),
+		s.BuildMetric("HeapSys", float64(ms.HeapSys)),
+		s.BuildMetric("LastGC", float64(ms.LastGC)),
+		s.BuildMetric("Lookups", float64(ms.Lookups)),
+		s.BuildMetric("MCacheInuse", float64(ms.MCacheInuse)),
+		s.BuildMetric("MCacheSys", float64(ms.MCacheSys)),
+		s.BuildMetric("MSpanInuse", float64(ms.MSpanInuse)),
+		s.BuildMetric("MSpanSys", float64(ms.MSpanSys)),
+		s.BuildMetric("Mallocs", float64(ms.Mallocs)),
+		s.BuildMetric("NextGC", float64(ms.NextGC)),
+		s.BuildMetric("NumForcedGC", float64(ms.NumForcedGC)),
+		s.BuildMetric("NumGC", float64(ms.NumGC)),
+		s.BuildMetric("OtherSys", float64(ms.OtherSys)),
+		s.BuildMetric("PauseTotalNs", float64(ms.PauseTotalNs)),
+		s.BuildMetric("StackInuse", float64(ms.StackInuse)),
+		s.BuildMetric("StackSys", float64(ms.StackSys)),
+		s.BuildMetric("Sys", float64(ms.Sys)),
+		s.BuildMetric("TotalAlloc", float64(ms.TotalAlloc)),
+		s.BuildMetric("RandomValue", rand.Float64()),
+		s.BuildMetric("PollCount", int64(1)),
+	}, nil
+}
+
+// psCollector память и загрузка CPU по ядрам из gopsutil.
+type psCollector struct{}
+
+func (psCollector) Name() string { return CollectPs }
+
+func (psCollector) Collect(cx ctx.Context) ([]*s.Metrics, error) {
+	psMem, err := mem.VirtualMemoryWithContext(cx)
+	if err != nil {
+		return nil, fmt.Errorf("virtual memory: %w", err)
+	}
+	metrics := []*s.Metrics{
+		s.BuildMetric("TotalMemory", float64(psMem.Total)),
+		s.BuildMetric("FreeMemory", float64(psMem.Free)),
+	}
+	psCPUs, err := cpu.PercentWithContext(cx, time.Second, true)
+	if err != nil {
+		return metrics, fmt.Errorf("cpu percent: %w", err)
+	}
+	for i, v := range psCPUs {
+		metrics = append(metrics, gauge("CPUutilization", map[string]string{"cpu": strconv.Itoa(i + 1)}, v))
+	}
+	return metrics, nil
+}
+
+type diskCollector struct {
+	io deltas
+}
+
+func (*diskCollector) Name() string { return CollectDisk }
+
+func (dc *diskCollector) Collect(cx ctx.Context) ([]*s.Metrics, error) {
+	parts, err := disk.PartitionsWithContext(cx, false)
+	if err != nil {
+		return nil, fmt.Errorf("disk partitions: %w", err)
+	}
+	var metrics []*s.Metrics
+	for _, part := range parts {
+		usage, err := disk.UsageWithContext(cx, part.Mountpoint)
+		if err != nil {
+			continue
+		}
+		labels := map[string]string{"mount": part.Mountpoint, "device": part.Device}
+		metrics = append(metrics,
+			gauge("DiskTotal", labels, float64(usage.Total)),
+			gauge("DiskFree", labels, float64(usage.Free)),
+			gauge("DiskUsedPercent", labels, usage.UsedPercent))
+	}
+	counters, err := disk.IOCountersWithContext(cx)
+	if err != nil {
+		return metrics, fmt.Errorf("disk io: %w", err)
+	}
+	for name, io := range counters {
+		labels := map[string]string{"device": name}
+		metrics = append(metrics,
+			dc.io.counter("DiskReadBytes", labels, io.ReadBytes),
+			dc.io.counter("DiskWriteBytes", labels, io.WriteBytes),
+			dc.io.counter("DiskReads", labels, io.ReadCount),
+			dc.io.counter("DiskWrites", labels, io.WriteCount))
+	}
+	return metrics, nil
+}
+
+type netCollector struct {
+	io deltas
+}
+
+func (*netCollector) Name() string { return CollectNet }
+
+func (nc *netCollector) Collect(cx ctx.Context) ([]*s.Metrics, error) {
+	counters, err := net.IOCountersWithContext(cx, true)
+	if err != nil {
+		return nil, fmt.Errorf("net io: %w", err)
+	}
+	metrics := make([]*s.Metrics, 0, len(counters)*6)
+	for _, io := range counters {
+		labels := map[string]string{"interface": io.Name}
+		metrics = append(metrics,
+			nc.io.counter("NetBytesSent", labels, io.BytesSent),
+			nc.io.counter("NetBytesRecv", labels, io.BytesRecv),
+			nc.io.counter("NetPacketsSent", labels, io.PacketsSent),
+			nc.io.counter("NetPacketsRecv", labels, io.PacketsRecv),
+			nc.io.counter("NetErrIn", labels, io.Errin),
+			nc.io.counter("NetErrOut", labels, io.Errout))
+	}
+	return metrics, nil
+}
+
+type loadCollector struct{}
+
+func (loadCollector) Name() string { return CollectLoad }
+
+func (loadCollector) Collect(cx ctx.Context) ([]*s.Metrics, error) {
+	avg, err := load.AvgWithContext(cx)
+	if err != nil {
+		return nil, fmt.Errorf("load average: %w", err)
+	}
+	return []*s.Metrics{
+		s.BuildMetric("Load1", avg.Load1),
+		s.BuildMetric("Load5", avg.Load5),
+		s.BuildMetric("Load15", avg.Load15),
+	}, nil
+}
+
+type uptimeCollector struct{}
+
+func (uptimeCollector) Name() string { return CollectUptime }
+
+func (uptimeCollector) Collect(cx ctx.Context) ([]*s.Metrics, error) {
+	uptime, err := host.UptimeWithContext(cx)
+	if err != nil {
+		return nil, fmt.Errorf("uptime: %w", err)
+	}
+	return []*s.Metrics{s.BuildMetric("Uptime", float64(uptime))}, nil
+}
+
+// fdCollector открытые дескрипторы системы из /proc/sys/fs/file-nr (только Linux).
+type fdCollector struct{}
+
+func (fdCollector) Name() string { return CollectFD }
+
+func (fdCollector) Collect(ctx.Context) ([]*s.Metrics, error) {
+	if runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("open fds: unsupported on %s", runtime.GOOS)
+	}
+	data, err := os.ReadFile("/proc/sys/fs/file-nr")
+	if err != nil {
+		return nil, fmt.Errorf("open fds: %w", err)
+	}
+	fields := strings.Fields(string(data)) // выделено, свободно, максимум
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("open fds: unexpected format %q", data)
+	}
+	open, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return nil, fmt.Errorf("open fds: %w", err)
+	}
+	maxFDs, err := strconv.ParseFloat(fields[2], 64)
+	if err != nil {
+		return nil, fmt.Errorf("open fds: %w", err)
+	}
+	return []*s.Metrics{
+		s.BuildMetric("OpenFDs", open),
+		s.BuildMetric("MaxFDs", maxFDs),
+	}, nil
+}
@@ -0,0 +1,119 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	s "metrics/internal/service"
+)
+
+func TestParseCollectors(t *testing.T) {
+	specs, err := ParseCollectors(" disk:30s,net,,disk ")
+	if err != nil || len(specs) != 2 || specs[0].Interval != 30*time.Second || specs[1].Interval != 0 {
+		t.Errorf("expected [disk:30s net], got %v (%v)", specs, err)
+	}
+	if _, err = ParseCollectors("disk,gpu"); !errors.Is(err, ErrUnknownCollector) {
+		t.Errorf("expected ErrUnknownCollector, got %v", err)
+	}
+	if _, err = ParseCollectors("disk:soon"); err == nil {
+		t.Error("expected error for invalid interval")
+	}
+
+	// встроенным сборщикам спецификация меняет только интервал
+	sm := NewSelfMonitor()
+	if !sm.SetInterval(CollectRuntime, time.Minute) || sm.SetInterval(CollectDisk, time.Minute) {
+		t.Error("expected interval override only for registered collectors")
+	}
+	if sm.collectors[0].interval != time.Minute || len(sm.collectors) != 2 {
+		t.Errorf("unexpected collectors %v", sm.collectors)
+	}
+}
+
+func TestCounterDeltasAccumulate(t *testing.T) {
+	sm := &SelfMonitor{results: make(map[string][]*s.Metrics)}
+	net := &netCollector{io: deltas{}}
+	_ = sm.Register(net, 0)
+	labels := map[string]string{"interface": "eth0"}
+	pending := func() int64 { return *sm.snapshot()[0].Delta }
+	for _, total := range []uint64{100, 150, 190} {
+		sm.store(CollectNet, []*s.Metrics{net.io.counter("NetBytesSent", labels, total)})
+	}
+	// первое наблюдение — база, затем 50 и 40 копятся до отправки
+	if got := pending(); got != 90 {
+		t.Errorf("expected pending delta 90, got %d", got)
+	}
+	// собранное во время отправки отчета не теряется
+	sent := sm.pendingCounters()
+	sm.store(CollectNet, []*s.Metrics{net.io.counter("NetBytesSent", labels, 200)})
+	sm.deductCounters(sent)
+	if got := pending(); got != 10 {
+		t.Errorf("expected delta 10 after report, got %d", got)
+	}
+	// сброс счетчика ОС не дает отрицательного приращения
+	sm.deductCounters(sm.pendingCounters())
+	sm.store(CollectNet, []*s.Metrics{net.io.counter("NetBytesSent", labels, 5)})
+	if got := pending(); got != 0 {
+		t.Errorf("expected zero delta after counter reset, got %d", got)
+	}
+}
+
+type funcCollector struct {
+	name    string
+	collect func() ([]*s.Metrics, error)
+}
+
+func (fc funcCollector) Name() string { return fc.name }
+
+func (fc funcCollector) Collect(context.Context) ([]*s.Metrics, error) { return fc.collect() }
+
+func TestCollectorIsolation(t *testing.T) {
+	sm := &SelfMonitor{results: make(map[string][]*s.Metrics), PollInterval: 10 * time.Millisecond}
+	var calls int
+	_ = sm.Register(funcCollector{"app", func() ([]*s.Metrics, error) {
+		calls++
+		return []*s.Metrics{s.BuildMetric("Requests", int64(2))}, nil
+	}}, 0)
+	_ = sm.Register(funcCollector{"broken", func() ([]*s.Metrics, error) {
+		panic("boom")
+	}}, 0)
+	_ = sm.Register(funcCollector{"failing", func() ([]*s.Metrics, error) {
+		return nil, errors.New("no data")
+	}}, 0)
+	if err := sm.Register(funcCollector{name: "app"}, 0); !errors.Is(err, ErrDuplicateCollector) {
+		t.Errorf("expected ErrDuplicateCollector, got %v", err)
+	}
+
+	cx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	for _, rc := range sm.collectors {
+		wg.Add(1)
+		go sm.runCollector(cx, wg, rc)
+	}
+	time.Sleep(55 * time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	snapshot := sm.snapshot()
+	if len(snapshot) != 1 || snapshot[0].ID != "Requests" {
+		t.Fatalf("expected only the healthy collector metrics, got %v", snapshot)
+	}
+	if want := int64(2 * calls); *snapshot[0].Delta != want || calls < 2 {
+		t.Errorf("expected accumulated delta %d, got %d", want, *snapshot[0].Delta)
+	}
+}
+
+func TestHostCollectors(t *testing.T) {
+	for _, name := range []string{CollectRuntime, CollectLoad, CollectUptime} {
+		c, _ := NewCollector(name)
+		metrics, err := c.Collect(context.Background())
+		if err != nil {
+			t.Skipf("%s is unavailable: %v", name, err)
+		}
+		if len(metrics) == 0 {
+			t.Errorf("%s: no metrics", name)
+		}
+	}
+}
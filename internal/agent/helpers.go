@@ -1,72 +1,146 @@
 package agent
 
 import (
-	"bytes"
 	ctx "context"
+	"errors"
+	"net"
 	"net/http"
-	"runtime"
 	"sync"
 
-	"metrics/internal/compress"
 	"metrics/internal/logger"
-	"metrics/internal/security"
 	s "metrics/internal/service"
 
+	"github.com/cenkalti/backoff/v4"
 	"go.uber.org/zap"
 )
 
-const numMemMetrics = 31
-
-var (
-	numAllMetrics = runtime.NumCPU() + numMemMetrics
-	randVal       float64
-	pollCount     int64
-	mets          = make([]*s.Metrics, numAllMetrics)
-)
+// ErrRejected сервер отклонил отчет (4xx): повторная отправка бессмысленна.
+var ErrRejected = errors.New("report rejected by server")
 
+// NewSelfMonitor агент со встроенными сборщиками runtime и памяти/CPU.
 func NewSelfMonitor() *SelfMonitor {
-	return &SelfMonitor{
-		cond: sync.NewCond(&sync.Mutex{}),
-	}
+	sm := &SelfMonitor{results: make(map[string][]*s.Metrics)}
+	_ = sm.Register(&runtimeCollector{}, 0)
+	_ = sm.Register(psCollector{}, 0)
+	return sm
 }
 
 func (sm *SelfMonitor) sendWorker(cx ctx.Context,
-	url string,
-	dataCh <-chan []byte,
+	reports <-chan report,
 	wg *sync.WaitGroup,
 ) {
-	for data := range dataCh {
-		compressData, _ := compress.Compress(data)
-
-		req, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader(compressData))
-		if sm.Key != "" {
-			sign := security.Hash(&data, sm.Key)
-			req.Header.Set("HashSHA256", sign)
-		}
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("Content-Encoding", "gzip")
-
+	for rep := range reports {
 		logger.Debug("REPORT...")
-		r, err := http.DefaultClient.Do(req)
-		if err != nil {
-			_ = s.Retry(cx, func() error {
-				r2, retErr := http.DefaultClient.Do(req)
-				closeBody(r2)
-				logger.Warn("retry result", zap.Error(retErr))
-				return retErr
-			})
-		} else {
+		if sm.Spool != nil && sm.Spool.Len() > 0 {
+			// очередь не пуста: отчет встает за ранее неотправленными
+			sm.spool(rep)
+			sm.drain(cx)
+			continue
+		}
+		err := sm.send(cx, rep.data)
+		switch {
+		case err == nil:
 			logger.Debug("success report!")
-			sm.cond.L.Lock()
-			pollCount = 0
-			sm.cond.L.Unlock()
+			sm.deduct(rep.sent)
+		case sm.Spool != nil && !errors.Is(err, ErrRejected):
+			sm.spool(rep)
+		default:
+			logger.Warn("report is lost", zap.Error(err))
 		}
-		closeBody(r)
 	}
 	wg.Done()
 	logger.Debug("goodbye from sendWorker")
 }
 
+// send отправляет отчет, повторяя попытки при сетевых ошибках и ответах 5xx.
+func (sm *SelfMonitor) send(cx ctx.Context, data []byte) error {
+	err := sm.sender.post(cx, data)
+	if err == nil || errors.Is(err, ErrRejected) {
+		return err
+	}
+	return s.Retry(cx, func() error {
+		retErr := sm.sender.post(cx, data)
+		logger.Warn("retry result", zap.Error(retErr))
+		if errors.Is(retErr, ErrRejected) {
+			return backoff.Permanent(retErr)
+		}
+		return retErr
+	})
+}
+
+// outboundIP адрес интерфейса, через который идет маршрут к серверу.
+// UDP-"соединение" пакетов не отправляет, а только выбирает маршрут.
+func outboundIP(addr string) string {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		logger.Warn("couldn't detect outbound ip", zap.Error(err))
+		return ""
+	}
+	defer conn.Close()
+	host, _, _ := net.SplitHostPort(conn.LocalAddr().String())
+	return host
+}
+
+// spool сохраняет неотправленный отчет. Вошедшие в него приращения
+// счетчиков теперь хранятся в очереди и вычитаются, как после отправки.
+func (sm *SelfMonitor) spool(rep report) {
+	if err := sm.Spool.Push(rep.data); err != nil {
+		logger.Warn("report is lost: spool error", zap.Error(err))
+		return
+	}
+	sm.deduct(rep.sent)
+	logger.Debug("report is spooled", zap.Int("queued", sm.Spool.Len()))
+}
+
+// drain отправляет отчеты из очереди от старых к новым до первой ошибки.
+// Одновременно очередь разбирает только один воркер. Метки времени в отчетах
+// не передаются: сервер ставит время приема, то есть время повторной отправки.
+func (sm *SelfMonitor) drain(cx ctx.Context) {
+	if !sm.drainMtx.TryLock() {
+		return
+	}
+	defer sm.drainMtx.Unlock()
+	for {
+		name, data, err := sm.Spool.Peek()
+		if errors.Is(err, ErrSpoolEmpty) {
+			logger.Debug("spool is drained")
+			return
+		}
+		err = sm.send(cx, data)
+		if err != nil && !errors.Is(err, ErrRejected) {
+			logger.Warn("spool drain is stopped", zap.Error(err))
+			return
+		}
+		if err != nil {
+			logger.Warn("spooled report is rejected", zap.Error(err))
+		}
+		sm.Spool.Remove(name)
+	}
+}
+
+// withSpoolStats добавляет к отчету состояние очереди неотправленных отчетов.
+// SpoolDropped — счетчик: в отчет идет прирост с прошлого отчета.
+// Вызывается под sm.mtx.
+func (sm *SelfMonitor) withSpoolStats(metrics []*s.Metrics) []*s.Metrics {
+	if sm.Spool == nil {
+		return metrics
+	}
+	dropped := sm.Spool.Dropped()
+	delta := dropped - sm.droppedReported
+	sm.droppedReported = dropped
+	return append(metrics[:len(metrics):len(metrics)],
+		s.BuildMetric("SpoolQueued", float64(sm.Spool.Len())),
+		s.BuildMetric("SpoolDropped", delta))
+}
+
+// deduct вычитает приращения, которые уже в отправленном
+// или сохраненном в очереди отчете.
+func (sm *SelfMonitor) deduct(sent sentCounters) {
+	sm.mtx.Lock()
+	sm.deductCounters(sent)
+	sm.mtx.Unlock()
+}
+
 func closeBody(r *http.Response) {
 	if r != nil && r.Body != nil {
 		r.Body.Close()
@@ -0,0 +1,61 @@
+package agent
+
+import (
+	ctx "context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"metrics/internal/compress"
+	"metrics/internal/logger"
+	"metrics/internal/security"
+	s "metrics/internal/service"
+
+	"github.com/pquerna/ffjson/ffjson"
+	"go.uber.org/zap"
+)
+
+// serve режим pull: вместо отправки отчетов агент отдает снимок метрик
+// серверу-сборщику. Счетчики отдаются нарастающим итогом с запуска агента
+// и не сбрасываются, поэтому несколько сборщиков получают одинаковые значения.
+func (sm *SelfMonitor) serve(cx ctx.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	mux := http.NewServeMux()
+	mux.HandleFunc(s.SnapshotPath, sm.snapshotHandler)
+	srv := &http.Server{Addr: sm.ServeAddress, Handler: mux}
+	go func() {
+		<-cx.Done()
+		_ = srv.Shutdown(ctx.WithoutCancel(cx))
+	}()
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Fatal("snapshot server error", zap.Error(err))
+	}
+	logger.Debug("goodbye from serve...")
+}
+
+func (sm *SelfMonitor) snapshotHandler(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	sm.mtx.Lock()
+	data, err := ffjson.Marshal(sm.snapshot())
+	sm.mtx.Unlock()
+	if err != nil {
+		logger.Warn("snapshot marshal error", zap.Error(err))
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if sm.Key != "" {
+		rw.Header().Set("HashSHA256", security.Hash(&data, sm.Key))
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	if strings.Contains(req.Header.Get("Accept-Encoding"), "gzip") {
+		if compressed, err := compress.Compress(data); err == nil {
+			data = compressed
+			rw.Header().Set("Content-Encoding", "gzip")
+		}
+	}
+	_, _ = rw.Write(data)
+}
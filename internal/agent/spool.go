@@ -0,0 +1,157 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"metrics/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+const (
+	spoolExt     = ".json"
+	spoolPerm    = 0o600
+	spoolDirPerm = 0o700
+)
+
+var ErrSpoolEmpty = errors.New("spool is empty")
+
+type spoolFile struct {
+	name string
+	size int64
+}
+
+// Spool ограниченная по размеру очередь неотправленных отчетов на диске.
+// Каждый отчет хранится в отдельном файле с возрастающим номером;
+// при превышении лимита удаляются самые старые отчеты.
+type Spool struct {
+	dir     string
+	limit   int64
+	mtx     sync.Mutex
+	files   []spoolFile
+	size    int64
+	seq     uint64
+	dropped atomic.Int64
+}
+
+func NewSpool(dir string, limit int64) (*Spool, error) {
+	if err := os.MkdirAll(dir, spoolDirPerm); err != nil {
+		return nil, fmt.Errorf("spool mkdir: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("spool read dir: %w", err)
+	}
+	sp := &Spool{dir: dir, limit: limit}
+	for _, e := range entries {
+		seq, ok := spoolSeq(e.Name())
+		if !ok || e.IsDir() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		sp.files = append(sp.files, spoolFile{name: e.Name(), size: info.Size()})
+		sp.size += info.Size()
+		sp.seq = max(sp.seq, seq)
+	}
+	sort.Slice(sp.files, func(i, j int) bool {
+		return sp.files[i].name < sp.files[j].name
+	})
+	sp.trim()
+	return sp, nil
+}
+
+func spoolSeq(name string) (uint64, bool) {
+	if !strings.HasSuffix(name, spoolExt) {
+		return 0, false
+	}
+	seq, err := strconv.ParseUint(strings.TrimSuffix(name, spoolExt), 10, 64)
+	return seq, err == nil
+}
+
+// Push сохраняет отчет в конец очереди.
+func (sp *Spool) Push(data []byte) error {
+	sp.mtx.Lock()
+	defer sp.mtx.Unlock()
+	sp.seq++
+	name := fmt.Sprintf("%020d%s", sp.seq, spoolExt)
+	tmp := filepath.Join(sp.dir, name+".tmp")
+	if err := os.WriteFile(tmp, data, spoolPerm); err != nil {
+		return fmt.Errorf("spool write: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(sp.dir, name)); err != nil {
+		return fmt.Errorf("spool rename: %w", err)
+	}
+	sp.files = append(sp.files, spoolFile{name: name, size: int64(len(data))})
+	sp.size += int64(len(data))
+	sp.trim()
+	return nil
+}
+
+// Peek возвращает самый старый отчет, не удаляя его из очереди.
+func (sp *Spool) Peek() (string, []byte, error) {
+	sp.mtx.Lock()
+	defer sp.mtx.Unlock()
+	for len(sp.files) > 0 {
+		f := sp.files[0]
+		data, err := os.ReadFile(filepath.Join(sp.dir, f.name))
+		if err == nil {
+			return f.name, data, nil
+		}
+		logger.Warn("spool: drop unreadable batch", zap.String("file", f.name), zap.Error(err))
+		sp.removeFirst()
+		sp.dropped.Add(1)
+	}
+	return "", nil, ErrSpoolEmpty
+}
+
+// Remove удаляет отправленный отчет, если он все еще в начале очереди.
+func (sp *Spool) Remove(name string) {
+	sp.mtx.Lock()
+	defer sp.mtx.Unlock()
+	if len(sp.files) > 0 && sp.files[0].name == name {
+		sp.removeFirst()
+	}
+}
+
+func (sp *Spool) Len() int {
+	sp.mtx.Lock()
+	defer sp.mtx.Unlock()
+	return len(sp.files)
+}
+
+// Dropped число отчетов, удаленных из-за переполнения или повреждения.
+func (sp *Spool) Dropped() int64 {
+	return sp.dropped.Load()
+}
+
+// trim удаляет самые старые отчеты, пока очередь больше лимита.
+// Вызывается под блокировкой.
+func (sp *Spool) trim() {
+	for sp.limit > 0 && sp.size > sp.limit && len(sp.files) > 0 {
+		logger.Warn("spool is full, drop the oldest batch",
+			zap.String("file", sp.files[0].name),
+			zap.Int64("dropped total", sp.dropped.Load()+1))
+		sp.removeFirst()
+		sp.dropped.Add(1)
+	}
+}
+
+func (sp *Spool) removeFirst() {
+	f := sp.files[0]
+	if err := os.Remove(filepath.Join(sp.dir, f.name)); err != nil && !os.IsNotExist(err) {
+		logger.Warn("spool: remove error", zap.Error(err))
+	}
+	sp.files = sp.files[1:]
+	sp.size -= f.size
+}
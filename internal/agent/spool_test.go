@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestSpoolLimit(t *testing.T) {
+	dir := t.TempDir()
+	sp, err := NewSpool(dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range []string{"aaaa", "bbbb", "cccc"} {
+		if err = sp.Push([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sp.Len() != 2 || sp.Dropped() != 1 {
+		t.Errorf("expected 2 queued and 1 dropped, got %d and %d", sp.Len(), sp.Dropped())
+	}
+	sm := &SelfMonitor{Spool: sp}
+	for _, want := range []int64{1, 0} { // SpoolDropped — прирост с прошлого отчета
+		stats := sm.withSpoolStats(nil)
+		if dropped := stats[1]; !dropped.IsCounter() || *dropped.Delta != want {
+			t.Errorf("expected SpoolDropped delta %d, got %v", want, dropped)
+		}
+	}
+
+	// очередь переживает перезапуск агента
+	reopened, err := NewSpool(dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, data, err := reopened.Peek()
+	if err != nil || string(data) != "bbbb" {
+		t.Fatalf("expected oldest batch bbbb, got %q (%v)", data, err)
+	}
+	reopened.Remove(name)
+	_ = reopened.Push([]byte("dddd"))
+	if _, data, _ = reopened.Peek(); string(data) != "cccc" {
+		t.Errorf("expected cccc, got %q", data)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	var mtx sync.Mutex
+	var got []string
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		data, _ := decompress(body)
+		mtx.Lock()
+		got = append(got, string(data))
+		mtx.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer serv.Close()
+
+	sp, err := NewSpool(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm := NewSelfMonitor()
+	sm.Spool = sp
+	for _, data := range []string{"[1]", "[2]", "[3]"} {
+		_ = sp.Push([]byte(data))
+	}
+	sm.sender = &httpSender{url: serv.URL + "/updates/", client: http.DefaultClient}
+	sm.drain(context.Background())
+
+	if sp.Len() != 0 {
+		t.Errorf("expected empty spool, got %d", sp.Len())
+	}
+	if len(got) != 3 || got[0] != "[1]" || got[2] != "[3]" {
+		t.Errorf("unexpected replay order: %v", got)
+	}
+}
+
+func decompress(b []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
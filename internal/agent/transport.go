@@ -0,0 +1,156 @@
+package agent
+
+import (
+	"bytes"
+	ctx "context"
+	"fmt"
+	"net/http"
+
+	"metrics/internal/compress"
+	"metrics/internal/logger"
+	pb "metrics/internal/proto"
+	"metrics/internal/security"
+	s "metrics/internal/service"
+
+	"github.com/pquerna/ffjson/ffjson"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	TransportHTTP = "http"
+	TransportGRPC = "grpc"
+)
+
+// sender делает одну попытку отправки отчета (JSON-массив метрик).
+// Повторы и очередь неотправленных отчетов — забота SelfMonitor.send.
+type sender interface {
+	post(ctx.Context, []byte) error
+	close()
+}
+
+func (sm *SelfMonitor) newSender() (sender, error) {
+	switch sm.Transport {
+	case "", TransportHTTP:
+		scheme := "http://"
+		client := http.DefaultClient
+		if sm.TLS != nil {
+			scheme = "https://"
+			client = &http.Client{Transport: &http.Transport{TLSClientConfig: sm.TLS}}
+		}
+		return &httpSender{
+			url:       scheme + sm.Address + "/updates/",
+			client:    client,
+			key:       sm.Key,
+			encryptor: sm.Encryptor,
+			realIP:    outboundIP(sm.Address),
+		}, nil
+	case TransportGRPC:
+		creds := insecure.NewCredentials()
+		if sm.TLS != nil {
+			creds = credentials.NewTLS(sm.TLS)
+		}
+		conn, err := grpc.NewClient(sm.Address,
+			grpc.WithTransportCredentials(creds),
+			grpc.WithChainUnaryInterceptor(compress.UnaryClientGzip, security.UnaryClientHash(sm.Key)),
+			grpc.WithChainStreamInterceptor(compress.StreamClientGzip, security.StreamClientHash(sm.Key)),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("grpc client: %w", err)
+		}
+		return &grpcSender{conn: conn, client: pb.NewMetricsClient(conn), realIP: outboundIP(sm.Address)}, nil
+	}
+	return nil, fmt.Errorf("unknown transport %q", sm.Transport)
+}
+
+type httpSender struct {
+	client    *http.Client
+	encryptor *security.Encryptor
+	url       string
+	key       string
+	realIP    string
+}
+
+func (hs *httpSender) post(cx ctx.Context, data []byte) error {
+	body, err := compress.Compress(data)
+	if err != nil {
+		return fmt.Errorf("compress report: %w", err)
+	}
+	if hs.encryptor != nil {
+		if body, err = hs.encryptor.Encrypt(body); err != nil {
+			return fmt.Errorf("encrypt report: %w", err)
+		}
+	}
+	req, err := http.NewRequestWithContext(cx, http.MethodPost, hs.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	if hs.key != "" {
+		req.Header.Set("HashSHA256", security.Hash(&data, hs.key))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	if hs.realIP != "" {
+		req.Header.Set(security.RealIPHeader, hs.realIP)
+	}
+	if hs.encryptor != nil {
+		req.Header.Set(security.EncryptionHeader, hs.encryptor.Scheme())
+	}
+	r, err := hs.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post report: %w", err)
+	}
+	closeBody(r)
+	switch {
+	case r.StatusCode >= http.StatusInternalServerError:
+		return fmt.Errorf("post report: status %d", r.StatusCode)
+	case r.StatusCode >= http.StatusBadRequest:
+		return fmt.Errorf("%w: status %d", ErrRejected, r.StatusCode)
+	}
+	return nil
+}
+
+func (hs *httpSender) close() {}
+
+// grpcSender отправляет отчеты по gRPC. Полезная нагрузка не шифруется
+// ключом -crypto-key: конфиденциальность обеспечивает TLS.
+type grpcSender struct {
+	conn   *grpc.ClientConn
+	client pb.MetricsClient
+	realIP string
+}
+
+func (gs *grpcSender) post(cx ctx.Context, data []byte) error {
+	var metrics []*s.Metrics
+	if err := ffjson.Unmarshal(data, &metrics); err != nil {
+		return fmt.Errorf("%w: unmarshal report: %v", ErrRejected, err)
+	}
+	req := &pb.UpdateBatchRequest{Metrics: make([]*pb.Metric, 0, len(metrics))}
+	for _, met := range metrics {
+		if met != nil {
+			req.Metrics = append(req.Metrics, pb.FromMetric(met))
+		}
+	}
+	if gs.realIP != "" {
+		cx = metadata.AppendToOutgoingContext(cx, security.RealIPMetadata, gs.realIP)
+	}
+	_, err := gs.client.UpdateBatch(cx, req)
+	switch status.Code(err) {
+	case codes.OK:
+		return nil
+	case codes.InvalidArgument, codes.Unauthenticated, codes.PermissionDenied, codes.Unimplemented:
+		return fmt.Errorf("%w: %v", ErrRejected, err)
+	}
+	return fmt.Errorf("post report: %w", err)
+}
+
+func (gs *grpcSender) close() {
+	if err := gs.conn.Close(); err != nil {
+		logger.Warn("grpc close error", zap.Error(err))
+	}
+}
@@ -0,0 +1,30 @@
+package compress
+
+import (
+	ctx "context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding/gzip" // регистрирует gzip и на стороне сервера
+)
+
+// UnaryClientGzip сжимает запросы unary-вызовов.
+func UnaryClientGzip(cx ctx.Context,
+	method string,
+	req, reply any,
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) error {
+	return invoker(cx, method, req, reply, cc, append(opts, grpc.UseCompressor(gzip.Name))...)
+}
+
+// StreamClientGzip сжимает сообщения потоковых вызовов.
+func StreamClientGzip(cx ctx.Context,
+	desc *grpc.StreamDesc,
+	cc *grpc.ClientConn,
+	method string,
+	streamer grpc.Streamer,
+	opts ...grpc.CallOption,
+) (grpc.ClientStream, error) {
+	return streamer(cx, desc, cc, method, append(opts, grpc.UseCompressor(gzip.Name))...)
+}
@@ -10,7 +10,8 @@ import (
 )
 
 type compressWriter struct {
-	w http.ResponseWriter
+	w   http.ResponseWriter
+	raw bool // поток событий не сжимается: каждый Write стал бы отдельным gzip-членом
 }
 
 func newCompressWriter(w http.ResponseWriter) *compressWriter {
@@ -24,6 +25,9 @@ func (c *compressWriter) Header() http.Header {
 }
 
 func (c *compressWriter) Write(p []byte) (int, error) {
+	if c.raw {
+		return c.w.Write(p)
+	}
 	compB, err := Compress(p)
 	if err != nil {
 		return 0, err
@@ -32,8 +36,14 @@ func (c *compressWriter) Write(p []byte) (int, error) {
 	return c.w.Write(compB)
 }
 
+// Unwrap нужен http.ResponseController для Flush потоковых ответов.
+func (c *compressWriter) Unwrap() http.ResponseWriter {
+	return c.w
+}
+
 func (c *compressWriter) WriteHeader(statusCode int) {
-	if statusCode < 300 {
+	c.raw = strings.HasPrefix(c.w.Header().Get("Content-Type"), "text/event-stream")
+	if statusCode < 300 && !c.raw {
 		c.w.Header().Set("Content-Encoding", "gzip")
 	}
 	c.w.WriteHeader(statusCode)
@@ -11,7 +11,9 @@ import (
 
 	"metrics/internal/agent"
 	log "metrics/internal/logger"
+	sec "metrics/internal/security"
 	"metrics/internal/server"
+	s "metrics/internal/service"
 
 	"go.uber.org/zap"
 )
@@ -30,6 +32,36 @@ type config struct {
 	ReportInterval  int    `env:"REPORT_INTERVAL" envDefault:"-1"`
 	Restore         bool   `env:"RESTORE" envDefault:"true"`
 	RateLimit       int    `env:"RATE_LIMIT"`
+	Buckets         string `env:"HISTOGRAM_BUCKETS"`
+	StatsdAddress   string `env:"STATSD_ADDRESS"`
+	WALSync         string `env:"WAL_SYNC"`
+	SnapshotKeep    int    `env:"SNAPSHOT_KEEP" envDefault:"-1"`
+	SpoolDir        string `env:"SPOOL_DIR"`
+	SpoolLimit      int64  `env:"SPOOL_LIMIT" envDefault:"-1"`
+	CryptoKey       string `env:"CRYPTO_KEY"`
+	TLSCert         string `env:"TLS_CERT"`
+	TLSKey          string `env:"TLS_KEY"`
+	TLSClientCA     string `env:"TLS_CLIENT_CA"`
+	TLSCA           string `env:"TLS_CA"`
+	TrustedSubnet   string `env:"TRUSTED_SUBNET"`
+	GRPCAddress     string `env:"GRPC_ADDRESS"`
+	Transport       string `env:"TRANSPORT"`
+	ScrapeTargets   string `env:"SCRAPE_TARGETS"`
+	ScrapeFile      string `env:"SCRAPE_FILE"`
+	ScrapeInterval  int    `env:"SCRAPE_INTERVAL" envDefault:"-1"`
+	ServeAddress    string `env:"SERVE_ADDRESS"`
+	Collectors      string `env:"COLLECTORS"`
+	RetentionRaw    int    `env:"RETENTION_RAW" envDefault:"-1"`      // часы
+	RetentionMinute int    `env:"RETENTION_1M" envDefault:"-1"`       // часы
+	RetentionHour   int    `env:"RETENTION_1H" envDefault:"-1"`       // часы
+	RetentionPeriod int    `env:"RETENTION_INTERVAL" envDefault:"-1"` // секунды
+	PartitionAhead  int    `env:"PARTITION_AHEAD" envDefault:"-1"`    // дни
+	AlertRules      string `env:"ALERT_RULES"`
+	AlertInterval   int    `env:"ALERT_INTERVAL" envDefault:"-1"`
+	WebhookURLs     string `env:"WEBHOOK_URLS"`
+	NotifyGroupBy   string `env:"NOTIFY_GROUP_BY"`
+	NotifyGroupWait int    `env:"NOTIFY_GROUP_WAIT" envDefault:"-1"` // секунды
+	NotifyRepeat    int    `env:"NOTIFY_REPEAT" envDefault:"-1"`     // секунды
 }
 
 type Option func(*config) error
@@ -59,8 +91,31 @@ func Configure(cx ctx.Context, appType AppType, opts ...Option) (Executable, err
 			zap.Int("store interval", cfg.StoreInterval),
 			zap.Bool("restore", cfg.Restore),
 			zap.String("file store", cfg.FileStoragePath),
+			zap.String("wal sync", cfg.WALSync),
+			zap.Int("snapshot keep", cfg.SnapshotKeep),
 			zap.String("database", cfg.DBAddress),
-			zap.String("decrypt key", cfg.Key))
+			zap.String("decrypt key", cfg.Key),
+			zap.String("histogram buckets", cfg.Buckets),
+			zap.String("statsd", cfg.StatsdAddress),
+			zap.String("crypto key", cfg.CryptoKey),
+			zap.String("tls cert", cfg.TLSCert),
+			zap.String("tls client ca", cfg.TLSClientCA),
+			zap.String("trusted subnet", cfg.TrustedSubnet),
+			zap.String("grpc", cfg.GRPCAddress),
+			zap.String("scrape targets", cfg.ScrapeTargets),
+			zap.String("scrape file", cfg.ScrapeFile),
+			zap.Int("scrape interval", cfg.ScrapeInterval),
+			zap.Int("retention raw", cfg.RetentionRaw),
+			zap.Int("retention 1m", cfg.RetentionMinute),
+			zap.Int("retention 1h", cfg.RetentionHour),
+			zap.Int("retention interval", cfg.RetentionPeriod),
+			zap.Int("partition ahead", cfg.PartitionAhead),
+			zap.String("alert rules", cfg.AlertRules),
+			zap.Int("alert interval", cfg.AlertInterval),
+			zap.String("webhooks", cfg.WebhookURLs),
+			zap.String("notify group by", cfg.NotifyGroupBy),
+			zap.Int("notify group wait", cfg.NotifyGroupWait),
+			zap.Int("notify repeat", cfg.NotifyRepeat))
 		return NewManager(cx, cfg)
 	default:
 		log.Info("SelfMonitor configuration",
@@ -68,7 +123,15 @@ func Configure(cx ctx.Context, appType AppType, opts ...Option) (Executable, err
 			zap.Int("poll interval", cfg.PollInterval),
 			zap.Int("report interval", cfg.ReportInterval),
 			zap.String("encrypt key", cfg.Key),
-			zap.Int("rate limit", cfg.RateLimit))
+			zap.Int("rate limit", cfg.RateLimit),
+			zap.String("spool dir", cfg.SpoolDir),
+			zap.Int64("spool limit", cfg.SpoolLimit),
+			zap.String("crypto key", cfg.CryptoKey),
+			zap.String("tls ca", cfg.TLSCA),
+			zap.String("tls cert", cfg.TLSCert),
+			zap.String("transport", cfg.Transport),
+			zap.String("serve", cfg.ServeAddress),
+			zap.String("collectors", cfg.Collectors))
 		return NewMonitor(cfg)
 	}
 }
@@ -76,8 +139,60 @@ func Configure(cx ctx.Context, appType AppType, opts ...Option) (Executable, err
 func NewManager(cx ctx.Context, cfg *config) (*server.MetricManager, error) {
 	var err error
 	manager := &server.MetricManager{Server: http.Server{}}
+	if cfg.Buckets != "" {
+		if manager.Buckets, err = s.ParseBuckets(cfg.Buckets); err != nil {
+			return nil, fmt.Errorf("histogram buckets: %w", err)
+		}
+	}
 	manager.Addr = cfg.Address
-	manager.Handler = getRoutes(cx, manager, cfg)
+	manager.StatsdAddr = cfg.StatsdAddress
+	manager.GRPCAddr = cfg.GRPCAddress
+	manager.Key = cfg.Key
+	manager.ScrapeTargets = splitList(cfg.ScrapeTargets)
+	manager.ScrapeFile = cfg.ScrapeFile
+	if cfg.ScrapeInterval <= 0 {
+		return nil, fmt.Errorf("scrape interval must be positive, got %d", cfg.ScrapeInterval)
+	}
+	manager.ScrapeInterval = time.Duration(cfg.ScrapeInterval) * time.Second
+	if cfg.AlertRules != "" {
+		if manager.AlertRules, err = server.LoadRules(cfg.AlertRules); err != nil {
+			return nil, fmt.Errorf("alert rules: %w", err)
+		}
+		if cfg.AlertInterval <= 0 {
+			return nil, fmt.Errorf("alert interval must be positive, got %d", cfg.AlertInterval)
+		}
+		manager.AlertInterval = time.Duration(cfg.AlertInterval) * time.Second
+	}
+	if manager.Webhooks, err = parseWebhooks(cfg.WebhookURLs); err != nil {
+		return nil, err
+	}
+	manager.NotifyGroupBy = splitList(cfg.NotifyGroupBy)
+	if cfg.NotifyGroupWait < 0 || cfg.NotifyRepeat < 0 {
+		return nil, fmt.Errorf("notify group wait and repeat must not be negative, got %d and %d",
+			cfg.NotifyGroupWait, cfg.NotifyRepeat)
+	}
+	manager.NotifyGroupWait = time.Duration(cfg.NotifyGroupWait) * time.Second
+	manager.NotifyRepeat = time.Duration(cfg.NotifyRepeat) * time.Second
+	var decryptor *sec.Decryptor
+	if cfg.CryptoKey != "" {
+		if decryptor, err = sec.LoadPrivateKey(cfg.CryptoKey); err != nil {
+			return nil, fmt.Errorf("crypto key: %w", err)
+		}
+	}
+	if cfg.TLSClientCA != "" && cfg.TLSCert == "" {
+		return nil, fmt.Errorf("tls: client CA %s requires -tls-cert", cfg.TLSClientCA)
+	}
+	if cfg.TLSCert != "" {
+		if manager.TLSConfig, err = sec.ServerTLSConfig(cfg.TLSCert, cfg.TLSKey, cfg.TLSClientCA); err != nil {
+			return nil, fmt.Errorf("tls: %w", err)
+		}
+	}
+	trusted, err := sec.ParseSubnets(cfg.TrustedSubnet)
+	if err != nil {
+		return nil, fmt.Errorf("trusted subnet: %w", err)
+	}
+	manager.Trusted = trusted
+	manager.Handler = getRoutes(cx, manager, cfg, decryptor, trusted)
 	manager.Storage, err = setStorage(cx, cfg)
 
 	return manager, err
@@ -89,11 +204,55 @@ func NewMonitor(cfg *config) (*agent.SelfMonitor, error) {
 	monitor.PollInterval = time.Duration(cfg.PollInterval) * time.Second
 	monitor.ReportInterval = time.Duration(cfg.ReportInterval) * time.Second
 	monitor.Key = cfg.Key
+	monitor.ServeAddress = cfg.ServeAddress
+	collectors, err := agent.ParseCollectors(cfg.Collectors)
+	if err != nil {
+		return nil, fmt.Errorf("collectors: %w", err)
+	}
+	for _, spec := range collectors {
+		if monitor.SetInterval(spec.Name, spec.Interval) {
+			continue // runtime и ps уже зарегистрированы
+		}
+		c, _ := agent.NewCollector(spec.Name)
+		if err = monitor.Register(c, spec.Interval); err != nil {
+			return nil, fmt.Errorf("collectors: %w", err)
+		}
+	}
+	switch cfg.Transport {
+	case agent.TransportHTTP, agent.TransportGRPC:
+		monitor.Transport = cfg.Transport
+	default:
+		return nil, fmt.Errorf("unknown transport %q", cfg.Transport)
+	}
 	if cfg.RateLimit <= 0 {
 		monitor.Rate = 1
 	} else {
 		monitor.Rate = cfg.RateLimit
 	}
+	if cfg.SpoolDir != "" {
+		spool, err := agent.NewSpool(cfg.SpoolDir, cfg.SpoolLimit)
+		if err != nil {
+			return nil, fmt.Errorf("spool configure error: %w", err)
+		}
+		monitor.Spool = spool
+	}
+	if cfg.CryptoKey != "" {
+		if monitor.Transport == agent.TransportGRPC {
+			return nil, fmt.Errorf("crypto key is not supported by grpc transport, use -tls-ca")
+		}
+		encryptor, err := sec.LoadPublicKey(cfg.CryptoKey)
+		if err != nil {
+			return nil, fmt.Errorf("crypto key: %w", err)
+		}
+		monitor.Encryptor = encryptor
+	}
+	if cfg.TLSCA != "" || cfg.TLSCert != "" {
+		tlsConfig, err := sec.ClientTLSConfig(cfg.TLSCA, cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("tls: %w", err)
+		}
+		monitor.TLS = tlsConfig
+	}
 
 	return monitor, nil
 }
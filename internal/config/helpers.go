@@ -4,6 +4,10 @@ import (
 	ctx "context"
 	"fmt"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
 
 	c "metrics/internal/compress"
 	log "metrics/internal/logger"
@@ -20,9 +24,21 @@ func setStorage(cx ctx.Context, cfg *config) (server.Storage, error) {
 		if err != nil {
 			return nil, fmt.Errorf("db configure error: %w", err)
 		}
+		if db.Retention, err = retention(cfg); err != nil {
+			return nil, fmt.Errorf("db configure error: %w", err)
+		}
+		db.PartitionAhead = cfg.PartitionAhead
 		return db, nil
 	case cfg.FileStoragePath != "":
-		fs := server.NewFileStore(cfg.FileStoragePath, cfg.StoreInterval)
+		walSync, err := server.ParseWALSync(cfg.WALSync)
+		if err != nil {
+			return nil, fmt.Errorf("file store configure error: %w", err)
+		}
+		fs, err := server.NewFileStore(cfg.FileStoragePath, cfg.StoreInterval, walSync)
+		if err != nil {
+			return nil, fmt.Errorf("file store configure error: %w", err)
+		}
+		fs.Keep = cfg.SnapshotKeep
 		if cfg.Restore {
 			fs.RestoreFromFile(cx)
 		}
@@ -31,7 +47,59 @@ func setStorage(cx ctx.Context, cfg *config) (server.Storage, error) {
 	return server.NewMemStore(), nil
 }
 
-func getRoutes(cx ctx.Context, m *server.MetricManager, cfg *config) *chi.Mux {
+// retention сроки хранения истории в БД; nil — свертка отключена.
+func retention(cfg *config) (*server.Retention, error) {
+	if cfg.RetentionRaw == 0 {
+		return nil, nil
+	}
+	switch {
+	case cfg.RetentionMinute < cfg.RetentionRaw:
+		return nil, fmt.Errorf("retention: 1m rollups (%dh) must outlive raw history (%dh)",
+			cfg.RetentionMinute, cfg.RetentionRaw)
+	case cfg.RetentionHour > 0 && cfg.RetentionHour < cfg.RetentionMinute:
+		return nil, fmt.Errorf("retention: 1h rollups (%dh) must outlive 1m rollups (%dh)",
+			cfg.RetentionHour, cfg.RetentionMinute)
+	case cfg.RetentionPeriod <= 0:
+		return nil, fmt.Errorf("retention interval must be positive, got %d", cfg.RetentionPeriod)
+	}
+	return &server.Retention{
+		Raw:      time.Duration(cfg.RetentionRaw) * time.Hour,
+		Minute:   time.Duration(cfg.RetentionMinute) * time.Hour,
+		Hour:     time.Duration(cfg.RetentionHour) * time.Hour,
+		Interval: time.Duration(cfg.RetentionPeriod) * time.Second,
+	}, nil
+}
+
+// splitList непустые элементы списка через запятую.
+func splitList(v string) []string {
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// parseWebhooks список адресов вебхуков; допускаются только http и https.
+func parseWebhooks(list string) ([]string, error) {
+	urls := splitList(list)
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("webhook %q: %w", raw, err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("webhook %q: expected http or https URL", raw)
+		}
+	}
+	return urls, nil
+}
+
+func getRoutes(cx ctx.Context, m *server.MetricManager, cfg *config,
+	decryptor *sec.Decryptor,
+	trusted []netip.Prefix,
+) *chi.Mux {
 	ctxMiddleware := func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			customCtx := wrapCtx{
@@ -43,15 +111,35 @@ func getRoutes(cx ctx.Context, m *server.MetricManager, cfg *config) *chi.Mux {
 	}
 	router := chi.NewRouter()
 	router.Use(log.WithHandlerLog)
+	router.Use(sec.PeerMiddleware)
+	if decryptor != nil {
+		router.Use(sec.DecryptMiddleware(decryptor, "/updates/"))
+	}
 	router.Use(c.GzipMiddleware)
-	router.Use(ctxMiddleware)
-	router.Get("/", m.GetAllHandler)
-	router.Get("/ping", m.PingHandler)
-	router.Post("/value/", sec.HashMiddleware(cfg.Key, m.GetJSON))
-	router.Get("/value/{type}/{id}", m.GetHandler)
-	router.Post("/update/", sec.HashMiddleware(cfg.Key, m.UpdateJSON))
-	router.Post("/update/{type}/{id}/{value}", m.UpdateHandler)
-	router.Post("/updates/", sec.HashMiddleware(cfg.Key, m.BatchHandler))
+	// /stream живет до отключения клиента и не получает серверный контекст:
+	// при остановке сервера подписки закрывает сам MetricManager
+	router.Get("/stream", m.StreamHandler)
+	router.Group(func(r chi.Router) {
+		r.Use(ctxMiddleware)
+		r.Get("/", m.RootHandler)
+		r.Get("/ping", m.PingHandler)
+		r.Get("/metrics", m.PrometheusHandler)
+		r.Post("/value/", sec.HashMiddleware(cfg.Key, m.GetJSON))
+		r.Get("/value/{type}/{id}", m.GetHandler)
+		r.Get("/values/", m.ListJSONHandler)
+		r.Get("/alerts", m.AlertsHandler)
+		r.Get("/silences", m.SilencesHandler)
+		r.Get("/query/{type}/{id}", m.QueryHandler)
+		r.Group(func(r chi.Router) { // запись только из доверенных подсетей
+			r.Use(sec.SubnetMiddleware(trusted))
+			r.Post("/update/", sec.HashMiddleware(cfg.Key, m.UpdateJSON))
+			r.Post("/update/{type}/{id}/{value}", m.UpdateHandler)
+			r.Post("/updates/", sec.HashMiddleware(cfg.Key, m.BatchHandler))
+			r.Post("/write", sec.HashMiddleware(cfg.Key, m.WriteHandler))
+			r.Post("/silences", sec.HashMiddleware(cfg.Key, m.AddSilenceHandler))
+			r.Delete("/silences/{id}", sec.HashMiddleware(cfg.Key, m.DeleteSilenceHandler))
+		})
+	})
 
 	return router
 }
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"metrics/internal/server"
+)
+
+func TestStreamDisconnect(t *testing.T) {
+	cx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mm := &server.MetricManager{Storage: server.NewMemStore()}
+	mm.EnableStream()
+	srv := httptest.NewServer(getRoutes(cx, mm, &config{}, nil, nil))
+	defer srv.Close()
+
+	reqCx, disconnect := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(reqCx, http.MethodGet, srv.URL+"/stream", http.NoBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if n := mm.StreamSubscribers(); n != 1 {
+		t.Fatalf("expected 1 subscriber, got %d", n)
+	}
+
+	disconnect()
+	deadline := time.Now().Add(5 * time.Second)
+	for mm.StreamSubscribers() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("subscription is not released after client disconnect")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
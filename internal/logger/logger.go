@@ -83,6 +83,10 @@ func (r *loggingResponse) WriteHeader(statusCode int) {
 	r.status = statusCode
 }
 
+func (r *loggingResponse) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
 func WithHandlerLog(h http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -0,0 +1,50 @@
+// Package proto контракт gRPC-транспорта метрик.
+package proto
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative metrics.proto
+
+import (
+	s "metrics/internal/service"
+)
+
+// FromMetric переводит метрику сервиса в сообщение gRPC.
+func FromMetric(met *s.Metrics) *Metric {
+	pm := &Metric{
+		Id:        met.ID,
+		Type:      met.MType,
+		Delta:     met.Delta,
+		Value:     met.Value,
+		Labels:    met.Labels,
+		Timestamp: met.Timestamp,
+	}
+	if met.Hist != nil {
+		pm.Histogram = &Histogram{
+			Bounds: met.Hist.Bounds,
+			Counts: met.Hist.Counts,
+			Sum:    met.Hist.Sum,
+			Count:  met.Hist.Count,
+		}
+	}
+	return pm
+}
+
+// ToMetric переводит сообщение gRPC в метрику сервиса.
+func (pm *Metric) ToMetric() *s.Metrics {
+	met := &s.Metrics{
+		ID:        pm.GetId(),
+		MType:     pm.GetType(),
+		Delta:     pm.Delta,
+		Value:     pm.Value,
+		Labels:    pm.GetLabels(),
+		Timestamp: pm.GetTimestamp(),
+	}
+	if h := pm.GetHistogram(); h != nil {
+		met.Hist = &s.Histogram{
+			Bounds: h.GetBounds(),
+			Counts: h.GetCounts(),
+			Sum:    h.GetSum(),
+			Count:  h.GetCount(),
+		}
+	}
+	return met
+}
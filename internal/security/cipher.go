@@ -0,0 +1,269 @@
+package security
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+
+	log "metrics/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+// EncryptionHeader схема шифрования тела запроса.
+const EncryptionHeader = "X-Encryption"
+
+const (
+	schemeRSA    = "rsa-oaep-aes256gcm"
+	schemeX25519 = "x25519-aes256gcm"
+	aesKeySize   = 32
+)
+
+var (
+	ErrKeyType    = errors.New("unsupported key type")
+	ErrCipherText = errors.New("malformed encrypted payload")
+)
+
+// Encryptor гибридное шифрование на открытом ключе сервера:
+// тело шифруется AES-256-GCM, ключ которого передается через RSA-OAEP
+// или выводится из эфемерного обмена X25519.
+type Encryptor struct {
+	rsaKey  *rsa.PublicKey
+	ecdhKey *ecdh.PublicKey
+}
+
+type Decryptor struct {
+	rsaKey  *rsa.PrivateKey
+	ecdhKey *ecdh.PrivateKey
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read key: %w", err)
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("read key: no PEM data in %s", path)
+	}
+	return block, nil
+}
+
+// LoadPublicKey читает открытый ключ RSA или X25519 в формате PEM (PKIX или PKCS1).
+func LoadPublicKey(path string) (*Encryptor, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	var key any
+	if block.Type == "RSA PUBLIC KEY" {
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	} else {
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse public key: %w", err)
+	}
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return &Encryptor{rsaKey: k}, nil
+	case *ecdh.PublicKey:
+		if k.Curve() == ecdh.X25519() {
+			return &Encryptor{ecdhKey: k}, nil
+		}
+	}
+	return nil, ErrKeyType
+}
+
+// LoadPrivateKey читает закрытый ключ RSA или X25519 в формате PEM (PKCS8 или PKCS1).
+func LoadPrivateKey(path string) (*Decryptor, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	var key any
+	if block.Type == "RSA PRIVATE KEY" {
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse private key: %w", err)
+	}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return &Decryptor{rsaKey: k}, nil
+	case *ecdh.PrivateKey:
+		if k.Curve() == ecdh.X25519() {
+			return &Decryptor{ecdhKey: k}, nil
+		}
+	}
+	return nil, ErrKeyType
+}
+
+// Scheme значение заголовка X-Encryption для зашифрованного тела.
+func (e *Encryptor) Scheme() string {
+	if e.rsaKey != nil {
+		return schemeRSA
+	}
+	return schemeX25519
+}
+
+// Encrypt формирует конверт:
+// RSA:    [2 байта длины ключа][зашифрованный ключ][nonce][шифротекст],
+// X25519: [32 байта эфемерного ключа][nonce][шифротекст].
+func (e *Encryptor) Encrypt(data []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	var key []byte
+	if e.rsaKey != nil {
+		key = make([]byte, aesKeySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("generate key: %w", err)
+		}
+		wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, e.rsaKey, key, nil)
+		if err != nil {
+			return nil, fmt.Errorf("wrap key: %w", err)
+		}
+		_ = binary.Write(buf, binary.BigEndian, uint16(len(wrapped)))
+		buf.Write(wrapped)
+	} else {
+		ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("generate key: %w", err)
+		}
+		shared, err := ephemeral.ECDH(e.ecdhKey)
+		if err != nil {
+			return nil, fmt.Errorf("ecdh: %w", err)
+		}
+		key = deriveKey(shared, ephemeral.PublicKey().Bytes(), e.ecdhKey.Bytes())
+		buf.Write(ephemeral.PublicKey().Bytes())
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+	buf.Write(nonce)
+	return gcm.Seal(buf.Bytes(), nonce, data, nil), nil
+}
+
+func (d *Decryptor) Decrypt(scheme string, data []byte) ([]byte, error) {
+	var key []byte
+	switch {
+	case scheme == schemeRSA && d.rsaKey != nil:
+		if len(data) < 2 {
+			return nil, ErrCipherText
+		}
+		n := int(binary.BigEndian.Uint16(data))
+		if len(data) < 2+n {
+			return nil, ErrCipherText
+		}
+		var err error
+		if key, err = rsa.DecryptOAEP(sha256.New(), nil, d.rsaKey, data[2:2+n], nil); err != nil {
+			return nil, fmt.Errorf("unwrap key: %w", err)
+		}
+		data = data[2+n:]
+	case scheme == schemeX25519 && d.ecdhKey != nil:
+		const pubSize = 32
+		if len(data) < pubSize {
+			return nil, ErrCipherText
+		}
+		ephemeral, err := ecdh.X25519().NewPublicKey(data[:pubSize])
+		if err != nil {
+			return nil, fmt.Errorf("ephemeral key: %w", err)
+		}
+		shared, err := d.ecdhKey.ECDH(ephemeral)
+		if err != nil {
+			return nil, fmt.Errorf("ecdh: %w", err)
+		}
+		key = deriveKey(shared, data[:pubSize], d.ecdhKey.PublicKey().Bytes())
+		data = data[pubSize:]
+	default:
+		return nil, fmt.Errorf("%w: scheme %q", ErrKeyType, scheme)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, ErrCipherText
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt: %w", err)
+	}
+	return plain, nil
+}
+
+// deriveKey ключ AES из общего секрета X25519 и открытых ключей сторон.
+func deriveKey(shared, ephemeralPub, recipientPub []byte) []byte {
+	h := sha256.New()
+	h.Write(shared)
+	h.Write(ephemeralPub)
+	h.Write(recipientPub)
+	return h.Sum(nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("aes: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("gcm: %w", err)
+	}
+	return gcm, nil
+}
+
+// DecryptMiddleware расшифровывает тело запросов с заголовком X-Encryption.
+// Запросы без заголовка передаются дальше без изменений, кроме POST
+// на пути required: они отклоняются с 400.
+func DecryptMiddleware(d *Decryptor, required ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			scheme := req.Header.Get(EncryptionHeader)
+			if scheme == "" {
+				if req.Method == http.MethodPost && slices.Contains(required, req.URL.Path) {
+					log.Warn("DecryptMiddleware: unencrypted request", zap.String("path", req.URL.Path))
+					http.Error(rw, "encryption is required", http.StatusBadRequest)
+					return
+				}
+				next.ServeHTTP(rw, req)
+				return
+			}
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				log.Warn("DecryptMiddleware: body err", zap.Error(err))
+				rw.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			plain, err := d.Decrypt(scheme, body)
+			if err != nil {
+				log.Warn("DecryptMiddleware: decrypt err", zap.Error(err))
+				rw.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			req.Body = io.NopCloser(bytes.NewReader(plain))
+			req.ContentLength = int64(len(plain))
+			req.Header.Del(EncryptionHeader)
+			next.ServeHTTP(rw, req)
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package security
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeKeys(t *testing.T, priv, pub any) (string, string) {
+	t.Helper()
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	privPath, pubPath := filepath.Join(dir, "private.pem"), filepath.Join(dir, "public.pem")
+	_ = os.WriteFile(privPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0o600)
+	_ = os.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0o600)
+	return privPath, pubPath
+}
+
+func TestHybridEncryption(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	xKey, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	tests := []struct {
+		name      string
+		priv, pub any
+	}{
+		{"rsa", rsaKey, &rsaKey.PublicKey},
+		{"x25519", xKey, xKey.PublicKey()},
+	}
+	payload := []byte(`[{"id":"PollCount","type":"counter","delta":5}]`)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			privPath, pubPath := writeKeys(t, test.priv, test.pub)
+			enc, err := LoadPublicKey(pubPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dec, err := LoadPrivateKey(privPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := enc.Encrypt(payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Contains(body, payload) {
+				t.Fatal("payload is not encrypted")
+			}
+
+			var got []byte
+			handler := DecryptMiddleware(dec, "/updates/")(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got, _ = io.ReadAll(r.Body)
+			}))
+			req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(body))
+			req.Header.Set(EncryptionHeader, enc.Scheme())
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK || !bytes.Equal(got, payload) {
+				t.Errorf("expected decrypted payload, got %d %q", rec.Code, got)
+			}
+
+			// поврежденный шифротекст отклоняется
+			body[len(body)-1] ^= 0xff
+			req = httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(body))
+			req.Header.Set(EncryptionHeader, enc.Scheme())
+			rec = httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("expected 400 for tampered body, got %d", rec.Code)
+			}
+
+			// без шифрования пакет отклоняется
+			req = httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(payload))
+			rec = httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("expected 400 for plain body, got %d", rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package security
+
+import (
+	ctx "context"
+	"fmt"
+
+	log "metrics/internal/logger"
+	pb "metrics/internal/proto"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// HashMetadata ключ метаданных с подписью, аналог заголовка HashSHA256.
+const HashMetadata = "hashsha256"
+
+var errSign = status.Error(codes.InvalidArgument, "hash mismatch")
+
+// SignMessage подпись сообщения: HMAC-SHA256 от детерминированной сериализации.
+func SignMessage(msg proto.Message, key string) (string, error) {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return "", fmt.Errorf("marshal message: %w", err)
+	}
+	return Hash(&data, key), nil
+}
+
+// UnaryHashInterceptor проверяет подпись из метаданных, как HashMiddleware.
+// Запросы без подписи пропускаются.
+func UnaryHashInterceptor(key string) grpc.UnaryServerInterceptor {
+	return func(cx ctx.Context,
+		req any,
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		signs := metadata.ValueFromIncomingContext(cx, HashMetadata)
+		msg, ok := req.(proto.Message)
+		if key == "" || len(signs) == 0 || !ok {
+			return handler(cx, req)
+		}
+		srcSign, err := SignMessage(msg, key)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		if srcSign != signs[0] {
+			log.Warn("UnaryHashInterceptor: sign error",
+				zap.String("method", info.FullMethod),
+				zap.String("src", srcSign),
+				zap.String("sign", signs[0]))
+			return nil, errSign
+		}
+		_ = grpc.SetHeader(cx, metadata.Pairs(HashMetadata, srcSign))
+		return handler(cx, req)
+	}
+}
+
+// StreamHashInterceptor проверяет подпись каждой метрики потока:
+// метаданные передаются один раз, поэтому подпись лежит в UpdateRequest.Hash.
+func StreamHashInterceptor(key string) grpc.StreamServerInterceptor {
+	return func(srv any,
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		if key == "" {
+			return handler(srv, ss)
+		}
+		return handler(srv, &verifyStream{ServerStream: ss, key: key})
+	}
+}
+
+type verifyStream struct {
+	grpc.ServerStream
+	key string
+}
+
+func (vs *verifyStream) RecvMsg(m any) error {
+	if err := vs.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	req, ok := m.(*pb.UpdateRequest)
+	if !ok || req.GetHash() == "" {
+		return nil
+	}
+	srcSign, err := SignMessage(req.GetMetric(), vs.key)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	if srcSign != req.GetHash() {
+		log.Warn("StreamHashInterceptor: sign error",
+			zap.String("src", srcSign),
+			zap.String("sign", req.GetHash()))
+		return errSign
+	}
+	return nil
+}
+
+// UnaryClientHash подписывает запросы unary-вызовов.
+func UnaryClientHash(key string) grpc.UnaryClientInterceptor {
+	return func(cx ctx.Context,
+		method string,
+		req, reply any,
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		if msg, ok := req.(proto.Message); ok && key != "" {
+			sign, err := SignMessage(msg, key)
+			if err != nil {
+				return err
+			}
+			cx = metadata.AppendToOutgoingContext(cx, HashMetadata, sign)
+		}
+		return invoker(cx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientHash подписывает каждую метрику потока.
+func StreamClientHash(key string) grpc.StreamClientInterceptor {
+	return func(cx ctx.Context,
+		desc *grpc.StreamDesc,
+		cc *grpc.ClientConn,
+		method string,
+		streamer grpc.Streamer,
+		opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		cs, err := streamer(cx, desc, cc, method, opts...)
+		if err != nil || key == "" {
+			return cs, err
+		}
+		return &signStream{ClientStream: cs, key: key}, nil
+	}
+}
+
+type signStream struct {
+	grpc.ClientStream
+	key string
+}
+
+func (ss *signStream) SendMsg(m any) error {
+	if req, ok := m.(*pb.UpdateRequest); ok {
+		sign, err := SignMessage(req.GetMetric(), ss.key)
+		if err != nil {
+			return err
+		}
+		req.Hash = sign
+	}
+	return ss.ClientStream.SendMsg(m)
+}
@@ -0,0 +1,156 @@
+package security
+
+import (
+	ctx "context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	log "metrics/internal/logger"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// RealIPHeader адрес агента, который он указывает сам.
+const RealIPHeader = "X-Real-IP"
+
+// RealIPMetadata ключ метаданных gRPC с адресом агента, аналог X-Real-IP.
+const RealIPMetadata = "x-real-ip"
+
+var errUntrusted = status.Error(codes.PermissionDenied, "untrusted client")
+
+// ParseSubnets разбирает список CIDR через запятую: "10.0.0.0/8,192.168.1.0/24".
+func ParseSubnets(list string) ([]netip.Prefix, error) {
+	var subnets []netip.Prefix
+	for _, cidr := range strings.Split(list, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("parse subnet: %w", err)
+		}
+		subnets = append(subnets, prefix.Masked())
+	}
+	return subnets, nil
+}
+
+// clientIP адрес из X-Real-IP, а без заголовка — адрес соединения.
+func clientIP(req *http.Request) (netip.Addr, error) {
+	return parseClientIP(req.Header.Get(RealIPHeader), req.RemoteAddr)
+}
+
+// grpcClientIP адрес из метаданных x-real-ip, а без них — адрес соединения.
+func grpcClientIP(cx ctx.Context) (netip.Addr, error) {
+	var host, remote string
+	if ips := metadata.ValueFromIncomingContext(cx, RealIPMetadata); len(ips) > 0 {
+		host = ips[0]
+	}
+	if p, ok := peer.FromContext(cx); ok && p.Addr != nil {
+		remote = p.Addr.String()
+	}
+	return parseClientIP(host, remote)
+}
+
+func parseClientIP(host, remote string) (netip.Addr, error) {
+	if host == "" {
+		var err error
+		if host, _, err = net.SplitHostPort(remote); err != nil {
+			return netip.Addr{}, fmt.Errorf("peer address: %w", err)
+		}
+	}
+	addr, err := netip.ParseAddr(strings.TrimSpace(host))
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("client ip: %w", err)
+	}
+	return addr.Unmap(), nil
+}
+
+func trusted(subnets []netip.Prefix, addr netip.Addr) bool {
+	for _, subnet := range subnets {
+		if subnet.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// SubnetMiddleware отвечает 403 клиентам вне доверенных подсетей.
+// Пустой список ничего не ограничивает.
+func SubnetMiddleware(subnets []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(subnets) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			addr, err := clientIP(req)
+			if err != nil {
+				log.Warn("SubnetMiddleware", zap.Error(err))
+				rw.WriteHeader(http.StatusForbidden)
+				return
+			}
+			if trusted(subnets, addr) {
+				next.ServeHTTP(rw, req)
+				return
+			}
+			log.Warn("SubnetMiddleware: untrusted client", zap.String("ip", addr.String()))
+			rw.WriteHeader(http.StatusForbidden)
+		})
+	}
+}
+
+// checkGRPCClient ошибка PermissionDenied для клиента вне доверенных подсетей.
+func checkGRPCClient(cx ctx.Context, subnets []netip.Prefix, method string) error {
+	addr, err := grpcClientIP(cx)
+	if err != nil {
+		log.Warn("SubnetInterceptor", zap.String("method", method), zap.Error(err))
+		return errUntrusted
+	}
+	if !trusted(subnets, addr) {
+		log.Warn("SubnetInterceptor: untrusted client",
+			zap.String("method", method), zap.String("ip", addr.String()))
+		return errUntrusted
+	}
+	return nil
+}
+
+// UnarySubnetInterceptor отклоняет вызовы клиентов вне доверенных подсетей,
+// как SubnetMiddleware. Пустой список ничего не ограничивает.
+func UnarySubnetInterceptor(subnets []netip.Prefix) grpc.UnaryServerInterceptor {
+	return func(cx ctx.Context,
+		req any,
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		if len(subnets) > 0 {
+			if err := checkGRPCClient(cx, subnets, info.FullMethod); err != nil {
+				return nil, err
+			}
+		}
+		return handler(cx, req)
+	}
+}
+
+// StreamSubnetInterceptor то же для потоковых вызовов.
+func StreamSubnetInterceptor(subnets []netip.Prefix) grpc.StreamServerInterceptor {
+	return func(srv any,
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		if len(subnets) > 0 {
+			if err := checkGRPCClient(ss.Context(), subnets, info.FullMethod); err != nil {
+				return err
+			}
+		}
+		return handler(srv, ss)
+	}
+}
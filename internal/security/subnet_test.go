@@ -0,0 +1,46 @@
+package security
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSubnetMiddleware(t *testing.T) {
+	subnets, err := ParseSubnets("10.0.0.0/8, 192.168.1.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := SubnetMiddleware(subnets)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	tests := []struct {
+		name   string
+		realIP string
+		remote string
+		status int
+	}{
+		{"header inside", "10.1.2.3", "127.0.0.1:5000", http.StatusOK},
+		{"header outside", "172.16.0.1", "10.0.0.1:5000", http.StatusForbidden},
+		{"peer inside", "", "192.168.1.20:5000", http.StatusOK},
+		{"peer outside", "", "192.168.2.20:5000", http.StatusForbidden},
+		{"garbage header", "localhost", "10.0.0.1:5000", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/update/", nil)
+			req.RemoteAddr = test.remote
+			if test.realIP != "" {
+				req.Header.Set(RealIPHeader, test.realIP)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != test.status {
+				t.Errorf("expected %d, got %d", test.status, rec.Code)
+			}
+		})
+	}
+	if _, err = ParseSubnets("10.0.0.0/33"); err == nil {
+		t.Error("expected error for invalid CIDR")
+	}
+}
@@ -0,0 +1,99 @@
+package security
+
+import (
+	ctx "context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+var ErrNoCerts = errors.New("no certificates found")
+
+func certPool(caFile string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("read CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%w in %s", ErrNoCerts, caFile)
+	}
+	return pool, nil
+}
+
+// ServerTLSConfig настройки TLS сервера. Если задан clientCA,
+// клиент обязан предъявить сертификат, подписанный этим CA (mTLS).
+func ServerTLSConfig(certFile, keyFile, clientCA string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load server cert: %w", err)
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if clientCA != "" {
+		if cfg.ClientCAs, err = certPool(clientCA); err != nil {
+			return nil, err
+		}
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// ClientTLSConfig настройки TLS агента: caFile — CA для проверки сервера
+// (пусто — системные корни), certFile/keyFile — клиентский сертификат для mTLS.
+func ClientTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	var err error
+	if caFile != "" {
+		if cfg.RootCAs, err = certPool(caFile); err != nil {
+			return nil, err
+		}
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client cert: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// PeerIdentity имя клиента из проверенного сертификата mTLS:
+// CommonName, а при его отсутствии первое DNS-имя. Без mTLS — пустая строка.
+func PeerIdentity(req *http.Request) string {
+	if req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
+		return ""
+	}
+	cert := req.TLS.PeerCertificates[0]
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+	return ""
+}
+
+type peerKey struct{}
+
+// PeerMiddleware кладет имя клиента mTLS в контекст запроса.
+func PeerMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if peer := PeerIdentity(req); peer != "" {
+			req = req.WithContext(ctx.WithValue(req.Context(), peerKey{}, peer))
+		}
+		next.ServeHTTP(rw, req)
+	})
+}
+
+// PeerFromContext имя клиента mTLS, сохраненное PeerMiddleware.
+func PeerFromContext(cx ctx.Context) string {
+	peer, _ := cx.Value(peerKey{}).(string)
+	return peer
+}
@@ -0,0 +1,103 @@
+package security
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert              *x509.Certificate
+	key               *ecdsa.PrivateKey
+	certPath, keyPath string
+}
+
+func issue(t *testing.T, dir, name string, parent *testCert, tmpl *x509.Certificate) *testCert {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	tmpl.Subject = pkix.Name{CommonName: name}
+	tmpl.NotBefore = time.Now().Add(-time.Minute)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalPKCS8PrivateKey(key)
+	tc := &testCert{
+		cert:     cert,
+		key:      key,
+		certPath: filepath.Join(dir, name+".crt"),
+		keyPath:  filepath.Join(dir, name+".key"),
+	}
+	_ = os.WriteFile(tc.certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	_ = os.WriteFile(tc.keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return tc
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := issue(t, dir, "ca", nil, &x509.Certificate{
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	})
+	srv := issue(t, dir, "server", ca, &x509.Certificate{
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	agent := issue(t, dir, "agent-01", ca, &x509.Certificate{
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+
+	serverCfg, err := ServerTLSConfig(srv.certPath, srv.keyPath, ca.certPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serv := httptest.NewUnstartedServer(PeerMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(PeerFromContext(r.Context())))
+	})))
+	serv.TLS = serverCfg
+	serv.StartTLS()
+	defer serv.Close()
+
+	clientCfg, err := ClientTLSConfig(ca.certPath, agent.certPath, agent.keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientCfg}}
+	resp, err := client.Get(serv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(peer) != "agent-01" {
+		t.Errorf("expected peer identity agent-01, got %q", peer)
+	}
+
+	// без клиентского сертификата соединение отклоняется
+	anonCfg, _ := ClientTLSConfig(ca.certPath, "", "")
+	anon := &http.Client{Transport: &http.Transport{TLSClientConfig: anonCfg}}
+	if resp, err = anon.Get(serv.URL); err == nil {
+		resp.Body.Close()
+		t.Error("expected handshake error without client certificate")
+	}
+}
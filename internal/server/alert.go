@@ -0,0 +1,257 @@
+package server
+
+import (
+	ctx "context"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	log "metrics/internal/logger"
+	s "metrics/internal/service"
+
+	"go.uber.org/zap"
+)
+
+const (
+	AlertPending  = "pending"
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+
+	resolvedKeep = 15 * time.Minute // сколько решенное оповещение видно в /alerts
+)
+
+// Alert состояние правила для одного ряда метрики.
+type Alert struct {
+	Labels     map[string]string `json:"labels,omitempty"`
+	FiredAt    *time.Time        `json:"firedAt,omitempty"`
+	ResolvedAt *time.Time        `json:"resolvedAt,omitempty"`
+	Rule       string            `json:"rule"`
+	Metric     string            `json:"metric"`
+	State      string            `json:"state"`
+	Summary    string            `json:"summary,omitempty"`
+	ActiveAt   time.Time         `json:"activeAt"`
+	Value      float64           `json:"value"`
+}
+
+// ruleResult проверка правила для ряда: value — значение метрики,
+// скорость или, для absence, секунды с последнего обновления.
+type ruleResult struct {
+	labels map[string]string
+	value  float64
+	active bool
+}
+
+// alertEngine периодически проверяет правила по текущим значениям хранилища.
+// Оповещение ряда проходит состояния pending → firing → resolved; условие,
+// снятое до истечения For, удаляет pending без оповещения.
+type alertEngine struct {
+	storage  Storage
+	rules    []*Rule
+	interval time.Duration
+	started  time.Time
+	notifier *notifier    // nil — уведомления не отправляются
+	mtx      sync.RWMutex // защищает alerts
+	alerts   map[string]*Alert
+}
+
+func newAlertEngine(mm *MetricManager) *alertEngine {
+	return &alertEngine{
+		storage:  mm.Storage,
+		rules:    mm.AlertRules,
+		interval: mm.AlertInterval,
+		started:  time.Now(),
+		alerts:   make(map[string]*Alert),
+	}
+}
+
+func (e *alertEngine) run(cx ctx.Context, done chan struct{}) {
+	defer close(done)
+	tick := time.NewTicker(e.interval)
+	defer tick.Stop()
+	for {
+		select {
+		case now := <-tick.C:
+			e.evaluate(cx, now)
+		case <-cx.Done():
+			log.Debug("goodbye from alerts...")
+			return
+		}
+	}
+}
+
+func (e *alertEngine) evaluate(cx ctx.Context, now time.Time) {
+	metrics, err := e.storage.List(cx)
+	if err != nil {
+		log.Warn("alerts: storage error", zap.Error(err))
+		return
+	}
+	// проверки могут читать историю, поэтому выполняются до блокировки
+	results := make([][]ruleResult, len(e.rules))
+	for i, rule := range e.rules {
+		results[i] = e.check(cx, rule, metrics, now)
+	}
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	seen := make(map[string]bool, len(e.alerts))
+	for i, rule := range e.rules {
+		for _, res := range results[i] {
+			key := rule.Name + (&s.Metrics{Labels: res.labels}).LabelString()
+			seen[key] = true
+			e.transition(key, rule, res, now)
+		}
+	}
+	for key, a := range e.alerts {
+		switch {
+		case !seen[key] && a.State != AlertResolved:
+			// ряд пропал из хранилища: условие больше не выполняется
+			e.transition(key, nil, ruleResult{value: a.Value}, now)
+		case a.State == AlertResolved && now.Sub(*a.ResolvedAt) > resolvedKeep:
+			delete(e.alerts, key)
+		}
+	}
+}
+
+func (e *alertEngine) check(cx ctx.Context, rule *Rule, metrics []*s.Metrics, now time.Time) []ruleResult {
+	var results []ruleResult
+	for _, met := range metrics {
+		if met == nil || !rule.matches(met) {
+			continue
+		}
+		res := ruleResult{labels: met.Labels}
+		switch rule.Kind {
+		case ruleThreshold:
+			if res.value = sampleValue(met); math.IsNaN(res.value) {
+				continue
+			}
+			res.active = compareThreshold(res.value, rule.Op, rule.Threshold)
+		case ruleAbsence:
+			last := e.lastUpdate(cx, met, rule.Absent, now)
+			res.active = last.IsZero() || now.Sub(last) > rule.Absent
+			res.value = rule.Absent.Seconds()
+			if !last.IsZero() {
+				res.value = now.Sub(last).Seconds()
+			}
+		case ruleRate:
+			var ok bool
+			if res.value, ok = e.rate(cx, met, rule.Window, now); !ok {
+				continue
+			}
+			res.active = compareThreshold(res.value, rule.Op, rule.Threshold)
+		}
+		results = append(results, res)
+	}
+	if len(results) == 0 && rule.Kind == ruleAbsence {
+		// ряда нет совсем: отсчет идет от запуска сервера
+		age := now.Sub(e.started)
+		results = append(results, ruleResult{
+			labels: rule.Labels,
+			value:  age.Seconds(),
+			active: age > rule.Absent,
+		})
+	}
+	return results
+}
+
+// lastUpdate время последнего сэмпла ряда; хранилища без времени
+// в текущих значениях (БД) отвечают по истории за окно absent.
+func (e *alertEngine) lastUpdate(cx ctx.Context, met *s.Metrics, absent time.Duration, now time.Time) time.Time {
+	if met.Timestamp != 0 {
+		return met.Time()
+	}
+	samples, err := e.storage.Range(cx, met, now.Add(-absent), now)
+	if err != nil || len(samples) == 0 {
+		return time.Time{}
+	}
+	return samples[len(samples)-1].Time()
+}
+
+// rate прирост счетчика в секунду за окно; false — сэмплов недостаточно.
+func (e *alertEngine) rate(cx ctx.Context, met *s.Metrics, window time.Duration, now time.Time) (float64, bool) {
+	samples, err := e.storage.Range(cx, met, now.Add(-window), now)
+	if err != nil || len(samples) < 2 {
+		return 0, false
+	}
+	vals := make([]float64, 0, len(samples))
+	for _, smp := range samples {
+		vals = append(vals, sampleValue(smp))
+	}
+	return fold(vals, math.NaN(), &rangeQuery{step: window, agg: aggRate}), true
+}
+
+// transition переводит оповещение ряда в следующее состояние.
+// rule == nil — ряд пропал, условие считается невыполненным.
+func (e *alertEngine) transition(key string, rule *Rule, res ruleResult, now time.Time) {
+	a, ok := e.alerts[key]
+	if !res.active {
+		switch {
+		case !ok:
+		case a.State == AlertPending:
+			delete(e.alerts, key)
+		case a.State == AlertFiring:
+			a.State = AlertResolved
+			a.ResolvedAt = &now
+			a.Value = res.value
+			log.Info("alert resolved", zap.String("rule", a.Rule), zap.Any("labels", a.Labels))
+			e.notifier.update(key, a, now)
+		}
+		return
+	}
+	if !ok || a.State == AlertResolved {
+		a = &Alert{
+			Rule:     rule.Name,
+			Metric:   rule.Metric,
+			Labels:   res.labels,
+			Summary:  rule.Summary,
+			State:    AlertPending,
+			ActiveAt: now,
+		}
+		e.alerts[key] = a
+	}
+	a.Value = res.value
+	if a.State == AlertPending && now.Sub(a.ActiveAt) >= rule.For {
+		a.State = AlertFiring
+		a.FiredAt = &now
+		log.Warn("alert firing", zap.String("rule", a.Rule), zap.Any("labels", a.Labels),
+			zap.Float64("value", a.Value))
+		e.notifier.update(key, a, now)
+	}
+}
+
+// list копии оповещений в состоянии state (пусто — все),
+// упорядоченные по правилу и меткам.
+func (e *alertEngine) list(state string) []*Alert {
+	e.mtx.RLock()
+	res := make([]*Alert, 0, len(e.alerts))
+	for _, a := range e.alerts {
+		if state == "" || a.State == state {
+			cp := *a
+			cp.Labels = maps.Clone(a.Labels)
+			res = append(res, &cp)
+		}
+	}
+	e.mtx.RUnlock()
+	slices.SortFunc(res, func(a, b *Alert) int {
+		if c := strings.Compare(a.Rule, b.Rule); c != 0 {
+			return c
+		}
+		return strings.Compare((&s.Metrics{Labels: a.Labels}).LabelString(),
+			(&s.Metrics{Labels: b.Labels}).LabelString())
+	})
+	return res
+}
+
+// matches ряд относится к правилу: имя, тип и заданные метки совпадают.
+func (rule *Rule) matches(met *s.Metrics) bool {
+	if met.ID != rule.Metric || (rule.MType != "" && met.MType != rule.MType) {
+		return false
+	}
+	for name, val := range rule.Labels {
+		if met.Labels[name] != val {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"metrics/internal/service"
+)
+
+func TestLoadRules(t *testing.T) {
+	dir := t.TempDir()
+	yml := filepath.Join(dir, "rules.yaml")
+	_ = os.WriteFile(yml, []byte(`
+rules:
+  - name: HighHeap
+    metric: HeapAlloc
+    condition: "> 500MB"
+    for: 2m
+  - name: AgentDown
+    metric: PollCount
+    absent: 60s
+  - name: ErrorRate
+    metric: errors
+    rate: ">= 5"
+`), 0o600)
+	rules, err := LoadRules(yml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 3 {
+		t.Fatalf("expected 3 rules, got %d", len(rules))
+	}
+	if r := rules[0]; r.Kind != ruleThreshold || r.Op != ">" || r.Threshold != 500<<20 || r.For != 2*time.Minute {
+		t.Errorf("unexpected threshold rule %+v", r)
+	}
+	if r := rules[1]; r.Kind != ruleAbsence || r.Absent != time.Minute {
+		t.Errorf("unexpected absence rule %+v", r)
+	}
+	if r := rules[2]; r.Kind != ruleRate || r.MType != "counter" || r.Window != defaultRateWindow {
+		t.Errorf("unexpected rate rule %+v", r)
+	}
+
+	invalid := map[string]string{
+		"no condition":  `{"rules": [{"name": "a", "metric": "m"}]}`,
+		"two kinds":     `{"rules": [{"name": "a", "metric": "m", "condition": "> 1", "absent": "1m"}]}`,
+		"bad operator":  `{"rules": [{"name": "a", "metric": "m", "condition": "~ 1"}]}`,
+		"rate of gauge": `{"rules": [{"name": "a", "metric": "m", "type": "gauge", "rate": "> 1"}]}`,
+		"duplicate":     `{"rules": [{"name": "a", "metric": "m", "absent": "1m"}, {"name": "a", "metric": "n", "absent": "1m"}]}`,
+	}
+	for name, data := range invalid {
+		path := filepath.Join(dir, "rules.json")
+		_ = os.WriteFile(path, []byte(data), 0o600)
+		if _, err := LoadRules(path); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestAlertStates(t *testing.T) {
+	ms := NewMemStore()
+	rules := []*Rule{
+		{Name: "HighHeap", Metric: "HeapAlloc", Kind: ruleThreshold, Op: ">", Threshold: 100, For: time.Minute},
+		{Name: "AgentDown", Metric: "PollCount", Kind: ruleAbsence, Absent: 45 * time.Second},
+	}
+	start := time.Now()
+	engine := newAlertEngine(&MetricManager{Storage: ms, AlertRules: rules})
+	engine.started = start
+	put := func(met *service.Metrics, at time.Time) {
+		met.Timestamp = at.UnixMilli()
+		_, _ = ms.Put(context.Background(), met)
+	}
+	state := func(rule string) string {
+		for _, a := range engine.list("") {
+			if a.Rule == rule {
+				return a.State
+			}
+		}
+		return ""
+	}
+
+	put(service.BuildMetric("HeapAlloc", float64(200)), start)
+	put(service.BuildMetric("PollCount", int64(1)), start)
+	steps := []struct {
+		at        time.Duration
+		heap      float64
+		heapState string
+		pollState string
+	}{
+		{at: 0, heap: 200, heapState: AlertPending},
+		{at: 30 * time.Second, heap: 200, heapState: AlertPending, pollState: ""},
+		{at: time.Minute, heap: 200, heapState: AlertFiring, pollState: AlertFiring},
+		{at: 2 * time.Minute, heap: 50, heapState: AlertResolved, pollState: AlertFiring},
+	}
+	for _, step := range steps {
+		now := start.Add(step.at)
+		put(service.BuildMetric("HeapAlloc", step.heap), now)
+		engine.evaluate(context.Background(), now)
+		if got := state("HighHeap"); got != step.heapState {
+			t.Errorf("at %v: expected HighHeap %q, got %q", step.at, step.heapState, got)
+		}
+		if got := state("AgentDown"); got != step.pollState {
+			t.Errorf("at %v: expected AgentDown %q, got %q", step.at, step.pollState, got)
+		}
+	}
+
+	// пропуск For: pending снимается без перехода в firing
+	put(service.BuildMetric("HeapAlloc", float64(500)), start.Add(3*time.Minute))
+	engine.evaluate(context.Background(), start.Add(3*time.Minute))
+	put(service.BuildMetric("HeapAlloc", float64(1)), start.Add(3*time.Minute+10*time.Second))
+	engine.evaluate(context.Background(), start.Add(3*time.Minute+10*time.Second))
+	if got := state("HighHeap"); got != "" {
+		t.Errorf("expected short pending alert to be dropped, got %q", got)
+	}
+}
@@ -0,0 +1,59 @@
+package server
+
+// Пакет сэмплов загружается через COPY во временную таблицу соединения
+// и сливается в текущие значения и историю двумя запросами.
+const (
+	stagingTable = "staging_samples"
+
+	createStaging = `CREATE TEMP TABLE IF NOT EXISTS staging_samples(
+				         seq INTEGER NOT NULL,
+				         type VARCHAR(16) NOT NULL,
+				         id VARCHAR(255) NOT NULL,
+				         labels JSONB NOT NULL,
+				         value DOUBLE PRECISION,
+				         delta BIGINT,
+				         created_at TIMESTAMPTZ NOT NULL
+			         ) ON COMMIT DELETE ROWS`
+)
+
+var stagingColumns = []string{"seq", "type", "id", "labels", "value", "delta", "created_at"}
+
+// В одном INSERT ... ON CONFLICT строка обновляется не более раза, поэтому
+// текущее значение пишется по метрике один раз: для gauge — последнее в пакете,
+// для счетчика — сумма приращений. В историю попадает каждый сэмпл; для
+// счетчика это накопленное значение: итог за вычетом последующих приращений.
+// Итоги счетчиков возвращаются, чтобы пакет содержал сохраненные значения.
+var stagingQueries = map[string]string{
+	mergeStagedGauges: `WITH last AS (
+				            SELECT DISTINCT ON (id, labels) id, labels, value FROM staging_samples
+				            WHERE type = 'gauge'
+				            ORDER BY id, labels, seq DESC),
+			            upd AS (
+				            INSERT INTO gauge(id, value, labels) SELECT id, value, labels FROM last
+				            ON CONFLICT(id, labels)
+				            DO UPDATE SET value = EXCLUDED.value)
+			            INSERT INTO gauge_history(id, value, created_at, labels)
+			            SELECT id, value, created_at, labels FROM staging_samples
+			            WHERE type = 'gauge'`,
+
+	mergeStagedCounters: `WITH agg AS (
+				              SELECT id, labels, sum(delta) AS delta FROM staging_samples
+				              WHERE type = 'counter'
+				              GROUP BY id, labels),
+			              upd AS (
+				              INSERT INTO counter(id, value, labels) SELECT id, delta, labels FROM agg
+				              ON CONFLICT(id, labels)
+				              DO UPDATE SET value = counter.value + EXCLUDED.value
+				              RETURNING id, labels, value),
+			              hist AS (
+				              INSERT INTO counter_history(id, value, created_at, labels)
+				              SELECT st.id,
+				                     upd.value - COALESCE(sum(st.delta) OVER (
+				                         PARTITION BY st.id, st.labels ORDER BY st.seq
+				                         ROWS BETWEEN 1 FOLLOWING AND UNBOUNDED FOLLOWING), 0),
+				                     st.created_at, st.labels
+				              FROM staging_samples st
+				              JOIN upd ON upd.id = st.id AND upd.labels = st.labels
+				              WHERE st.type = 'counter')
+			              SELECT id, labels, value FROM upd`,
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	ctx "context"
+	"fmt"
+	"time"
+
+	s "metrics/internal/service"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var histogramQueries = map[string]string{
+	initHistogram: `INSERT INTO histogram(id, labels, bounds, counts, sum, count)
+			        VALUES($1, $2, $3, $4, 0, 0)
+			        ON CONFLICT(id, labels) DO NOTHING`,
+
+	lockHistogram: `SELECT bounds, counts, sum, count FROM histogram
+			        WHERE id = $1 AND labels = $2
+			        FOR UPDATE`,
+
+	updateHistogram: `WITH upd AS (
+				          UPDATE histogram SET bounds = $3, counts = $4, sum = $5, count = $6
+				          WHERE id = $1 AND labels = $2
+				          RETURNING id, labels, bounds, counts, sum, count)
+			          INSERT INTO histogram_history(id, labels, bounds, counts, sum, count, created_at)
+			          SELECT id, labels, bounds, counts, sum, count, $7 FROM upd`,
+
+	selectHistogram: `SELECT bounds, counts, sum, count FROM histogram
+			          WHERE id = $1 AND labels = $2`,
+
+	rangeHistogram: `SELECT bounds, counts, sum, count, created_at FROM histogram_history
+			         WHERE id = $1 AND labels = $2 AND created_at BETWEEN $3 AND $4
+			         ORDER BY created_at`,
+
+	selectAllHistograms: `SELECT id, labels, bounds, counts, sum, count FROM histogram`,
+}
+
+// putHistogram сливает гистограмму с сохраненной: корзины складываются
+// на стороне приложения под блокировкой строки в рамках транзакции tx.
+// Новая гистограмма из одиночного наблюдения получает корзины buckets.
+func putHistogram(cx ctx.Context, tx pgx.Tx, met *s.Metrics, buckets []float64) error {
+	bounds := buckets
+	switch {
+	case met.Hist != nil:
+		bounds = met.Hist.Bounds
+	case bounds == nil:
+		bounds = s.DefaultBuckets
+	}
+	empty := s.NewHistogram(bounds)
+	if _, err := tx.Exec(cx, initHistogram, met.ID, labelSet(met), empty.Bounds, empty.Counts); err != nil {
+		return fmt.Errorf("init histogram: %w", err)
+	}
+	old := &s.Metrics{Hist: &s.Histogram{}}
+	if err := tx.QueryRow(cx, lockHistogram, met.ID, labelSet(met)).Scan(
+		&old.Hist.Bounds, &old.Hist.Counts, &old.Hist.Sum, &old.Hist.Count); err != nil {
+		return fmt.Errorf("lock histogram: %w", err)
+	}
+	if err := met.MergeMetrics(old); err != nil {
+		return err
+	}
+	h := met.Hist
+	if _, err := tx.Exec(cx, updateHistogram, met.ID, labelSet(met),
+		h.Bounds, h.Counts, h.Sum, h.Count, met.Time()); err != nil {
+		return fmt.Errorf("upsert histogram: %w", err)
+	}
+	return nil
+}
+
+func getHistogram(cx ctx.Context, conn *pgxpool.Conn, met *s.Metrics) (*s.Metrics, error) {
+	h := &s.Histogram{}
+	if err := conn.QueryRow(cx, selectHistogram, met.ID, labelSet(met)).Scan(
+		&h.Bounds, &h.Counts, &h.Sum, &h.Count); err != nil {
+		return nil, fmt.Errorf("db get failed to execute query: %w", err)
+	}
+	met.Hist = h
+	return met, nil
+}
+
+func listHistograms(cx ctx.Context, conn *pgxpool.Conn) ([]*s.Metrics, error) {
+	rows, err := conn.Query(cx, selectAllHistograms)
+	if err != nil {
+		return nil, fmt.Errorf("dbList histograms query err: %w", err)
+	}
+	defer rows.Close()
+	var metrics []*s.Metrics
+	for rows.Next() {
+		met := &s.Metrics{MType: "histogram", Hist: &s.Histogram{}}
+		if err := rows.Scan(&met.ID, &met.Labels,
+			&met.Hist.Bounds, &met.Hist.Counts, &met.Hist.Sum, &met.Hist.Count); err != nil {
+			return nil, fmt.Errorf("dbList histograms scan err: %w", err)
+		}
+		if len(met.Labels) == 0 {
+			met.Labels = nil
+		}
+		metrics = append(metrics, met)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("dbList histograms rows error: %w", err)
+	}
+	return metrics, nil
+}
+
+// scanHistogramSamples снимки гистограммы по запросу истории или агрегатов.
+func scanHistogramSamples(cx ctx.Context, conn *pgxpool.Conn, met *s.Metrics,
+	query string, from, to time.Time,
+) ([]*s.Metrics, error) {
+	rows, err := conn.Query(cx, query, met.ID, labelSet(met), from, to)
+	if err != nil {
+		return nil, fmt.Errorf("db range query err: %w", err)
+	}
+	defer rows.Close()
+	var samples []*s.Metrics
+	for rows.Next() {
+		h := &s.Histogram{}
+		var created time.Time
+		if err := rows.Scan(&h.Bounds, &h.Counts, &h.Sum, &h.Count, &created); err != nil {
+			return nil, fmt.Errorf("db range scan err: %w", err)
+		}
+		samples = append(samples, &s.Metrics{
+			ID:        met.ID,
+			MType:     met.MType,
+			Labels:    met.Labels,
+			Hist:      h,
+			Timestamp: created.UnixMilli(),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("db range rows error: %w", err)
+	}
+	return samples, nil
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	ctx "context"
+	"fmt"
+	"strings"
+
+	s "metrics/internal/service"
+)
+
+// listSources текущие значения метрик каждого типа в общем наборе колонок:
+// первым в UNION может оказаться любой источник, поэтому имена и типы заданы везде.
+var listSources = map[string]string{
+	"gauge": `SELECT 'gauge' AS type, id, labels, value, NULL::BIGINT AS delta,
+	                 NULL::DOUBLE PRECISION[] AS bounds, NULL::BIGINT[] AS counts,
+	                 NULL::DOUBLE PRECISION AS sum, NULL::BIGINT AS count FROM gauge`,
+	"counter": `SELECT 'counter' AS type, id, labels, NULL::DOUBLE PRECISION AS value, value AS delta,
+	                   NULL::DOUBLE PRECISION[] AS bounds, NULL::BIGINT[] AS counts,
+	                   NULL::DOUBLE PRECISION AS sum, NULL::BIGINT AS count FROM counter`,
+	"histogram": `SELECT 'histogram' AS type, id, labels, NULL::DOUBLE PRECISION AS value,
+	                     NULL::BIGINT AS delta, bounds, counts, sum, count FROM histogram`,
+}
+
+var listTypes = []string{"gauge", "counter", "histogram"}
+
+// ListPage отбирает метрики и листает их на стороне БД: курсор сравнивается
+// с ключом сортировки строкой (row comparison), поэтому страница не требует
+// чтения предыдущих. Синтаксис регулярных выражений Go и Postgres различается,
+// поэтому шаблон имени проверяется при чтении строк, и лимит — тоже здесь.
+func (db *DataBase) ListPage(cx ctx.Context, f *ListFilter) ([]*s.Metrics, error) {
+	conn, err := db.connectWithRetry(cx)
+	if err != nil {
+		return nil, fmt.Errorf("db list page conn err: %w", err)
+	}
+	defer conn.Release()
+
+	query, args := buildListQuery(f)
+	rows, err := conn.Query(cx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("db list page query err: %w", err)
+	}
+	defer rows.Close()
+	var metrics []*s.Metrics
+	for rows.Next() {
+		var (
+			met    s.Metrics
+			bounds []float64
+			counts []uint64
+			sum    *float64
+			count  *uint64
+		)
+		if err := rows.Scan(&met.MType, &met.ID, &met.Labels,
+			&met.Value, &met.Delta, &bounds, &counts, &sum, &count); err != nil {
+			return nil, fmt.Errorf("db list page scan err: %w", err)
+		}
+		if len(met.Labels) == 0 {
+			met.Labels = nil
+		}
+		if f.Pattern != nil && !f.Pattern.MatchString(met.ID) {
+			continue
+		}
+		if met.IsHistogram() && sum != nil && count != nil {
+			met.Hist = &s.Histogram{Bounds: bounds, Counts: counts, Sum: *sum, Count: *count}
+		}
+		metrics = append(metrics, &met)
+		if f.Limit > 0 && len(metrics) == f.Limit {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("db list page rows error: %w", err)
+	}
+	return metrics, nil
+}
+
+func buildListQuery(f *ListFilter) (string, []any) {
+	types := f.Types
+	if len(types) == 0 {
+		types = listTypes
+	}
+	sources := make([]string, 0, len(types))
+	for _, mtype := range types {
+		sources = append(sources, listSources[mtype])
+	}
+
+	var (
+		conds []string
+		args  []any
+	)
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if f.Prefix != "" {
+		conds = append(conds, "id LIKE "+arg(likePrefix(f.Prefix)))
+	}
+
+	key := "type, id, labels"
+	if f.SortBy == sortByID {
+		key = "id, type, labels"
+	}
+	op, dir := ">", ""
+	if f.Desc {
+		op, dir = "<", " DESC"
+	}
+	if cur := f.After; cur != nil {
+		labels := cur.Labels
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		vals := map[string]any{"type": cur.MType, "id": cur.ID, "labels": labels}
+		casts := map[string]string{"type": "::TEXT", "id": "::TEXT", "labels": "::JSONB"}
+		cols := strings.Split(key, ", ")
+		params := make([]string, len(cols))
+		for i, col := range cols {
+			params[i] = arg(vals[col]) + casts[col]
+		}
+		conds = append(conds, fmt.Sprintf("(%s) %s (%s)", key, op, strings.Join(params, ", ")))
+	}
+
+	var b strings.Builder
+	b.WriteString("SELECT type, id, labels, value, delta, bounds, counts, sum, count FROM (")
+	b.WriteString(strings.Join(sources, " UNION ALL "))
+	b.WriteString(") m")
+	if len(conds) > 0 {
+		b.WriteString(" WHERE ")
+		b.WriteString(strings.Join(conds, " AND "))
+	}
+	b.WriteString(" ORDER BY ")
+	b.WriteString(strings.ReplaceAll(key, ",", dir+",") + dir)
+	if f.Limit > 0 && f.Pattern == nil {
+		b.WriteString(" LIMIT " + arg(f.Limit))
+	}
+	return b.String(), args
+}
+
+// likePrefix экранирует спецсимволы LIKE в префиксе.
+func likePrefix(prefix string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(prefix) + "%"
+}
@@ -4,6 +4,7 @@ import (
 	ctx "context"
 	"errors"
 	"fmt"
+	"time"
 
 	log "metrics/internal/logger"
 	s "metrics/internal/service"
@@ -20,6 +21,7 @@ type dbOperation uint8
 const (
 	insertMetric dbOperation = iota
 	selectMetric
+	selectRange
 )
 
 const (
@@ -28,10 +30,29 @@ const (
 	selectGauge   = "selectGauge"
 	selectCounter = "selectCounter"
 	selectAll     = "selectAll"
+	rangeGauge    = "rangeGauge"
+	rangeCounter  = "rangeCounter"
+
+	mergeStagedGauges   = "mergeStagedGauges"
+	mergeStagedCounters = "mergeStagedCounters"
+
+	initHistogram       = "initHistogram"
+	lockHistogram       = "lockHistogram"
+	updateHistogram     = "updateHistogram"
+	selectHistogram     = "selectHistogram"
+	rangeHistogram      = "rangeHistogram"
+	selectAllHistograms = "selectAllHistograms"
 )
 
 type DataBase struct {
 	*pgxpool.Pool
+	Retention      *Retention // nil — история хранится целиком
+	PartitionAhead int        // на сколько дней вперед создаются секции истории
+	buckets        []float64  // корзины новых гистограмм из одиночных наблюдений
+}
+
+func (db *DataBase) setBuckets(buckets []float64) {
+	db.buckets = buckets
 }
 
 var ErrConnDB = errors.New("db connection error")
@@ -44,23 +65,42 @@ func NewDB(cx ctx.Context, addr string) (*DataBase, error) {
 	if err != nil {
 		return nil, fmt.Errorf("newDB: unable to parse connection string: %w", err)
 	}
+	config.AfterConnect = prepareQueries // именованные запросы нужны каждому соединению пула
 	pool, err := pgxpool.NewWithConfig(cx, config)
 	if err != nil {
 		return nil, fmt.Errorf("newDB: unable to create connection pool: %w", err)
 	}
-	if err := prepareQueries(cx, pool); err != nil {
-		return nil, err
+	if err := pool.Ping(cx); err != nil {
+		return nil, fmt.Errorf("newDB: %w", err)
 	}
-	return &DataBase{pool}, nil
+	return &DataBase{Pool: pool, PartitionAhead: DefaultPartitionAhead}, nil
 }
 
 func (db *DataBase) Put(cx ctx.Context, met *s.Metrics) (*s.Metrics, error) {
+	if err := checkPut(met); err != nil {
+		return nil, err
+	}
 	conn, err := db.connectWithRetry(cx)
 	if err != nil {
 		return nil, fmt.Errorf("db put conn err: %w", err)
 	}
 	defer conn.Release()
 
+	met.Stamp(time.Now())
+	if met.IsHistogram() {
+		tx, err := conn.Begin(cx)
+		if err != nil {
+			return nil, fmt.Errorf("failed transaction beginning: %w", err)
+		}
+		defer func() { _ = tx.Rollback(cx) }()
+		if err = putHistogram(cx, tx, met, db.buckets); err != nil {
+			return nil, fmt.Errorf("db put histogram error: %w", err)
+		}
+		if err = tx.Commit(cx); err != nil {
+			return nil, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return met, nil
+	}
 	var val any
 	query := getQuery(insertMetric, met)
 	if err = conn.QueryRow(cx, query, met.ToSlice()...).Scan(&val); err != nil {
@@ -77,9 +117,12 @@ func (db *DataBase) Get(cx ctx.Context, met *s.Metrics) (*s.Metrics, error) {
 	}
 	defer conn.Release()
 
+	if met.IsHistogram() {
+		return getHistogram(cx, conn, met)
+	}
 	query := getQuery(selectMetric, met)
 	var val any
-	if err = conn.QueryRow(cx, query, met.ID).Scan(&val); err != nil {
+	if err = conn.QueryRow(cx, query, met.ID, labelSet(met)).Scan(&val); err != nil {
 		return nil, fmt.Errorf("db get failed to execute query: %w", err)
 	}
 	setVal(met, val)
@@ -100,20 +143,30 @@ func (db *DataBase) List(cx ctx.Context) (metrics []*s.Metrics, err error) {
 	defer rows.Close()
 	for rows.Next() {
 		var met s.Metrics
-		var val any
-		if err := rows.Scan(&met.ID, &val); err != nil {
+		if err := rows.Scan(&met.MType, &met.ID, &met.Labels, &met.Value, &met.Delta); err != nil {
 			return nil, fmt.Errorf("dbList query scan err: %w", err)
 		}
-		setVal(&met, val)
+		if len(met.Labels) == 0 {
+			met.Labels = nil
+		}
 		metrics = append(metrics, &met)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("dbList query rows error: %w", err)
 	}
-	return metrics, nil
+	hists, err := listHistograms(cx, conn)
+	if err != nil {
+		return nil, err
+	}
+	return append(metrics, hists...), nil
 }
 
 func (db *DataBase) PutBatch(cx ctx.Context, mets []*s.Metrics) error {
+	for _, met := range mets {
+		if err := checkPut(met); err != nil {
+			return err
+		}
+	}
 	conn, err := db.connectWithRetry(cx)
 	if err != nil {
 		return fmt.Errorf("putBatch err: %w", err)
@@ -126,51 +179,194 @@ func (db *DataBase) PutBatch(cx ctx.Context, mets []*s.Metrics) error {
 	}
 	defer func() { _ = tx.Rollback(cx) }()
 
-	batch := &pgx.Batch{}
+	now := time.Now()
+	var rows [][]any
+	var hists []*s.Metrics
 	for _, met := range mets {
-		batch.Queue(getQuery(insertMetric, met), met.ToSlice()...)
+		met.Stamp(now)
+		if met.IsHistogram() {
+			hists = append(hists, met)
+			continue
+		}
+		rows = append(rows, []any{int32(len(rows)), met.MType, met.ID, labelSet(met),
+			met.Value, met.Delta, met.Time()})
 	}
-	br := tx.SendBatch(cx, batch)
-	if _, err := br.Exec(); err != nil {
-		return fmt.Errorf("batch exec failed: %w", err)
+	for _, met := range hists {
+		if err := putHistogram(cx, tx, met, db.buckets); err != nil {
+			return fmt.Errorf("batch histogram error: %w", err)
+		}
 	}
-	if err := br.Close(); err != nil {
-		return fmt.Errorf("failed to close batch res: %w", err)
+	var totals map[string]int64
+	if len(rows) > 0 {
+		if _, err := tx.CopyFrom(cx, pgx.Identifier{stagingTable}, stagingColumns,
+			pgx.CopyFromRows(rows)); err != nil {
+			return fmt.Errorf("batch copy failed: %w", err)
+		}
+		if _, err := tx.Exec(cx, mergeStagedGauges); err != nil {
+			return fmt.Errorf("batch merge failed: %w", err)
+		}
+		if totals, err = mergeCounters(cx, tx); err != nil {
+			return err
+		}
 	}
 	if err := tx.Commit(cx); err != nil {
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
+	setCounterTotals(mets, totals)
 	return nil
 }
 
-func prepareQueries(cx ctx.Context, pool *pgxpool.Pool) error {
-	conn, err := pool.Acquire(cx)
+// mergeCounters сливает счетчики пакета и возвращает их итоги по ключу метрики.
+func mergeCounters(cx ctx.Context, tx pgx.Tx) (map[string]int64, error) {
+	rows, err := tx.Query(cx, mergeStagedCounters)
+	if err != nil {
+		return nil, fmt.Errorf("batch merge failed: %w", err)
+	}
+	defer rows.Close()
+	totals := make(map[string]int64)
+	for rows.Next() {
+		met := s.Metrics{MType: "counter"}
+		var total int64
+		if err := rows.Scan(&met.ID, &met.Labels, &total); err != nil {
+			return nil, fmt.Errorf("batch merge scan err: %w", err)
+		}
+		totals[met.Key()] = total
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("batch merge rows error: %w", err)
+	}
+	return totals, nil
+}
+
+// setCounterTotals заменяет приращения счетчиков пакета сохраненными
+// значениями, как в истории: у последнего сэмпла метрики — итог из БД.
+func setCounterTotals(mets []*s.Metrics, totals map[string]int64) {
+	for i := len(mets) - 1; i >= 0; i-- {
+		met := mets[i]
+		if !met.IsCounter() || met.Delta == nil {
+			continue
+		}
+		key := met.Key()
+		total, ok := totals[key]
+		if !ok {
+			continue
+		}
+		delta := *met.Delta
+		*met.Delta = total
+		totals[key] = total - delta
+	}
+}
+
+// Range сэмплы метрики в интервале [from, to]. Части интервала старше сроков
+// хранения сырой истории читаются из агрегатов (см. Retention.segments).
+func (db *DataBase) Range(cx ctx.Context, met *s.Metrics, from, to time.Time) ([]*s.Metrics, error) {
+	conn, err := db.connectWithRetry(cx)
 	if err != nil {
-		return fmt.Errorf("prepareQueries conn err: %w", err)
+		return nil, fmt.Errorf("db range conn err: %w", err)
 	}
 	defer conn.Release()
 
+	var samples []*s.Metrics
+	for _, seg := range db.Retention.segments(from, to, time.Now()) {
+		var part []*s.Metrics
+		if seg.resolution == resolutionRaw {
+			part, err = rangeRaw(cx, conn, met, seg.from, seg.to)
+		} else {
+			part, err = rangeRollup(cx, conn, met, seg)
+		}
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, part...)
+	}
+	return samples, nil
+}
+
+func rangeRaw(cx ctx.Context, conn *pgxpool.Conn, met *s.Metrics, from, to time.Time) ([]*s.Metrics, error) {
+	if met.IsHistogram() {
+		return scanHistogramSamples(cx, conn, met, rangeHistogram, from, to)
+	}
+	rows, err := conn.Query(cx, getQuery(selectRange, met), met.ID, labelSet(met), from, to)
+	if err != nil {
+		return nil, fmt.Errorf("db range query err: %w", err)
+	}
+	defer rows.Close()
+	var samples []*s.Metrics
+	for rows.Next() {
+		var val any
+		var created time.Time
+		if err := rows.Scan(&val, &created); err != nil {
+			return nil, fmt.Errorf("db range scan err: %w", err)
+		}
+		smp := &s.Metrics{
+			ID:        met.ID,
+			MType:     met.MType,
+			Labels:    met.Labels,
+			Timestamp: created.UnixMilli(),
+		}
+		setVal(smp, val)
+		samples = append(samples, smp)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("db range rows error: %w", err)
+	}
+	return samples, nil
+}
+
+func prepareQueries(cx ctx.Context, conn *pgx.Conn) error {
 	queries := map[string]string{
-		insertGauge: `INSERT INTO gauge(id, value) VALUES($1, $2) 
-			          ON CONFLICT(id) 
-				      DO UPDATE SET value = EXCLUDED.value
-				      RETURNING value`,
+		insertGauge: `WITH upd AS (
+				          INSERT INTO gauge(id, value, labels) VALUES($1, $2, $4)
+				          ON CONFLICT(id, labels)
+				          DO UPDATE SET value = EXCLUDED.value
+				          RETURNING id, value, labels)
+			          INSERT INTO gauge_history(id, value, created_at, labels)
+			          SELECT id, value, $3, labels FROM upd
+			          RETURNING value`,
+
+		insertCounter: `WITH upd AS (
+				            INSERT INTO counter(id, value, labels) VALUES($1, $2, $4)
+				            ON CONFLICT(id, labels)
+				            DO UPDATE SET value = counter.value + excluded.value
+				            RETURNING id, value, labels)
+			            INSERT INTO counter_history(id, value, created_at, labels)
+			            SELECT id, value, $3, labels FROM upd
+			            RETURNING value`,
 
-		insertCounter: `INSERT INTO counter(id, value) VALUES($1, $2) 
-			            ON CONFLICT(id) 
-				        DO UPDATE SET value = counter.value + excluded.value
-				        RETURNING value`,
+		selectGauge: `SELECT value FROM gauge WHERE id = $1 AND labels = $2`,
 
-		selectGauge: `SELECT value FROM gauge WHERE id = $1`,
+		selectCounter: `SELECT value FROM counter WHERE id = $1 AND labels = $2`,
 
-		selectCounter: `SELECT value FROM counter WHERE id = $1`,
+		rangeGauge: `SELECT value, created_at FROM gauge_history
+			         WHERE id = $1 AND labels = $2 AND created_at BETWEEN $3 AND $4
+			         ORDER BY created_at`,
 
-		selectAll: `SELECT id, value FROM gauge
+		rangeCounter: `SELECT value, created_at FROM counter_history
+			           WHERE id = $1 AND labels = $2 AND created_at BETWEEN $3 AND $4
+			           ORDER BY created_at`,
+
+		selectAll: `SELECT 'gauge', id, labels, value, NULL::BIGINT FROM gauge
 			        UNION ALL
-			        SELECT id, value FROM counter;`,
+			        SELECT 'counter', id, labels, NULL::DOUBLE PRECISION, value FROM counter;`,
+	}
+	for name, query := range histogramQueries {
+		queries[name] = query
+	}
+	for name, query := range retentionQueries {
+		queries[name] = query
+	}
+	for name, query := range partitionQueries {
+		queries[name] = query
+	}
+	for name, query := range stagingQueries {
+		queries[name] = query
+	}
+	// промежуточная таблица живет в соединении, поэтому создается до подготовки запросов
+	if _, err := conn.Exec(cx, createStaging); err != nil {
+		return fmt.Errorf("prepareQueries staging err: %w", err)
 	}
 	for name, query := range queries {
-		if _, err = conn.Conn().Prepare(cx, name, query); err != nil {
+		if _, err := conn.Prepare(cx, name, query); err != nil {
 			return fmt.Errorf("prepareQueries %s err: %w", name, err)
 		}
 	}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	s "metrics/internal/service"
+)
+
+func TestDBPutBatchValidation(t *testing.T) {
+	db := &DataBase{} // проверка идет до соединения с БД
+	val := 1.0
+	tests := []struct {
+		met  *s.Metrics
+		want error
+	}{
+		{&s.Metrics{ID: "a", MType: "summary", Value: &val}, s.ErrInvalidType},
+		{&s.Metrics{ID: "b", MType: "counter"}, ErrNoValue},
+		{&s.Metrics{ID: "c", MType: "gauge"}, ErrNoValue},
+	}
+	for _, test := range tests {
+		err := db.PutBatch(context.Background(), []*s.Metrics{s.BuildMetric("ok", val), test.met})
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s: expected %v, got %v", test.met.ID, test.want, err)
+		}
+		if putStatus(err) != http.StatusBadRequest {
+			t.Errorf("%s: expected client error status", test.met.ID)
+		}
+	}
+}
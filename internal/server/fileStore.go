@@ -2,8 +2,10 @@ package server
 
 import (
 	ctx "context"
+	"errors"
 	"fmt"
 	"os"
+	"sync"
 	"time"
 
 	log "metrics/internal/logger"
@@ -13,111 +15,199 @@ import (
 	"go.uber.org/zap"
 )
 
-const permissions = 0o666
+const (
+	permissions = 0o666
+	DefaultKeep = 3 // число хранимых предыдущих снимков по умолчанию
+)
 
 type FileStorage struct {
 	MemStorage
 	FilePath string
+	Keep     int // число хранимых предыдущих снимков
 	interval int
+	wal      *wal
+	// persistMtx делает атомарными запись в память с журналом и снимок с очисткой журнала
+	persistMtx *sync.Mutex
 }
 
-func NewFileStore(path string, interval int) *FileStorage {
+func NewFileStore(path string, interval int, walSync WALSync) (*FileStorage, error) {
+	journal, err := openWAL(path+walSuffix, walSync)
+	if err != nil {
+		return nil, err
+	}
 	return &FileStorage{
 		MemStorage: *NewMemStore(),
 		FilePath:   path,
+		Keep:       DefaultKeep,
 		interval:   interval,
-	}
+		wal:        journal,
+		persistMtx: &sync.Mutex{},
+	}, nil
 }
 
 func (fs *FileStorage) Put(cx ctx.Context, met *s.Metrics) (*s.Metrics, error) {
-	m, _ := fs.MemStorage.Put(cx, met)
-	if fs.interval <= 0 {
-		if err := fs.dump(cx); err != nil {
-			return m, err
-		}
+	if err := fs.PutBatch(cx, []*s.Metrics{met}); err != nil {
+		return nil, err
 	}
-	return m, nil
+	return met, nil
 }
 
+// PutBatch пишет итоговые значения в журнал до изменения памяти: при ошибке
+// журнала память не меняется, и повтор запроса клиентом не удвоит счетчики.
 func (fs *FileStorage) PutBatch(cx ctx.Context, mets []*s.Metrics) error {
-	_ = fs.MemStorage.PutBatch(cx, mets)
-	if fs.interval <= 0 {
-		if err := fs.dump(cx); err != nil {
-			return err
-		}
+	fs.persistMtx.Lock()
+	fs.mtx.Lock()
+	err := fs.putBatch(mets, time.Now(), fs.wal.append)
+	fs.mtx.Unlock()
+	fs.persistMtx.Unlock()
+	if err != nil {
+		return err
 	}
-	return nil
+	return fs.dumpIfLarge(cx)
 }
 
 func (fs *FileStorage) Close() {
+	if err := fs.wal.close(); err != nil {
+		log.Warn("FileStorage.Close(): wal error", zap.Error(err))
+	}
 	log.Info("File storage is closed;)")
 }
 
+// RestoreFromFile восстанавливает снимок и проигрывает поверх него журнал.
 func (fs *FileStorage) RestoreFromFile(cx ctx.Context) {
-	b, err := os.ReadFile(fs.FilePath)
+	fs.restoreSnapshot(cx)
+	samples, err := fs.wal.replay()
+	if err != nil {
+		log.Warn("RestoreFromFile: wal replay error", zap.Error(err))
+	}
+	now := time.Now()
+	fs.mtx.Lock()
+	for _, m := range samples {
+		fs.restore(m, now)
+	}
+	fs.mtx.Unlock()
+	log.Debug("success restore from file!", zap.Int("wal samples", len(samples)))
+}
+
+// restoreSnapshot загружает самый свежий целый снимок,
+// при повреждении текущего переходя к предыдущим.
+func (fs *FileStorage) restoreSnapshot(cx ctx.Context) {
+	for _, path := range snapshotPaths(fs.FilePath, fs.Keep) {
+		mets, err := readSnapshot(cx, path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			log.Warn("RestoreFromFile: skip snapshot", zap.String("path", path), zap.Error(err))
+			continue
+		}
+		now := time.Now()
+		fs.mtx.Lock()
+		for _, m := range mets {
+			fs.restore(m, now)
+		}
+		fs.mtx.Unlock()
+		log.Debug("snapshot restored", zap.String("path", path))
+		return
+	}
+	log.Warn("RestoreFromFile: no valid snapshot found")
+}
+
+func readSnapshot(cx ctx.Context, path string) ([]*s.Metrics, error) {
+	b, err := os.ReadFile(path)
 	if err != nil && !os.IsPermission(err) && !os.IsNotExist(err) {
-		if err := s.Retry(cx, func() error {
-			b, err = os.ReadFile(fs.FilePath)
+		err = s.Retry(cx, func() error {
+			b, err = os.ReadFile(path)
 			return err
-		}); err != nil {
-			log.Warn("RestoreFromFile: err after retry", zap.Error(err))
-			return
-		}
+		})
 	}
 	if err != nil {
-		log.Warn("RestoreFromFile", zap.Error(err))
-		return
+		return nil, err
 	}
-	var mets []*s.Metrics
-	if err := ffjson.Unmarshal(b, &mets); err != nil {
-		log.Warn("RestoreFromFile: unmarshall error", zap.Error(err))
-		return
+	body, err := decodeSnapshot(b)
+	if err != nil {
+		return nil, err
 	}
-	for _, m := range mets {
-		_, _ = fs.MemStorage.Put(cx, m)
+	var mets []*s.Metrics
+	if err := ffjson.Unmarshal(body, &mets); err != nil {
+		return nil, fmt.Errorf("unmarshall error: %w", err)
 	}
-	log.Debug("success restore from file!")
+	return mets, nil
 }
 
+// dump сохраняет в файл всю историю сэмплов в хронологическом порядке,
+// последний сэмпл каждой метрики является ее текущим значением.
+// После успешной записи снимка журнал очищается.
 func (fs *FileStorage) dump(cx ctx.Context) error {
-	items, _ := fs.List(cx)
-	metBytes, err := ffjson.Marshal(items)
+	fs.persistMtx.Lock()
+	defer fs.persistMtx.Unlock()
+	metBytes, err := ffjson.Marshal(fs.samples())
 	if err != nil {
 		return fmt.Errorf("dump: %w", err)
 	}
-	err = os.WriteFile(fs.FilePath, metBytes, permissions)
-	if err != nil && !os.IsPermission(err) {
+	err = writeSnapshot(fs.FilePath, metBytes, fs.Keep)
+	if err != nil && !errors.Is(err, os.ErrPermission) {
 		err = s.Retry(cx, func() error {
-			return os.WriteFile(fs.FilePath, metBytes, permissions)
+			return writeSnapshot(fs.FilePath, metBytes, fs.Keep)
 		})
 	}
 	if err != nil {
 		return fmt.Errorf("dump: %w", err)
 	}
+	if err = fs.wal.truncate(); err != nil {
+		return fmt.Errorf("dump: %w", err)
+	}
 	log.Debug("success dump!")
 	return nil
 }
 
+// dumpIfLarge снимает снимок, когда периодические снимки отключены,
+// а журнал вырос больше walSnapshotSize.
+func (fs *FileStorage) dumpIfLarge(cx ctx.Context) error {
+	if fs.interval > 0 || fs.wal.len() < walSnapshotSize {
+		return nil
+	}
+	return fs.dump(cx)
+}
+
 func (fs *FileStorage) dumpWait(cx ctx.Context, dumpWaitDone chan struct{}) {
-	if fs.interval <= 0 {
+	if fs.interval <= 0 && fs.wal.policy != WALSyncEverySec {
 		close(dumpWaitDone)
 		return
 	}
-	ticker := time.NewTicker(time.Duration(fs.interval) * time.Second)
+	var dumpC, syncC <-chan time.Time
+	var tickers []*time.Ticker
+	if fs.interval > 0 {
+		dumpTick := time.NewTicker(time.Duration(fs.interval) * time.Second)
+		tickers = append(tickers, dumpTick)
+		dumpC = dumpTick.C
+	}
+	if fs.wal.policy == WALSyncEverySec {
+		syncTick := time.NewTicker(time.Second)
+		tickers = append(tickers, syncTick)
+		syncC = syncTick.C
+	}
 	go func() {
-		defer ticker.Stop()
+		defer close(dumpWaitDone)
+		defer func() {
+			for _, t := range tickers {
+				t.Stop()
+			}
+		}()
 		for {
 			select {
-			case <-ticker.C:
+			case <-dumpC:
 				if err := fs.dump(cx); err != nil {
+					// следующий тик повторит попытку, синхронизация WAL продолжается
 					log.Warn("fs.dumpWithinterval(): Couldn't save data to file",
 						zap.Error(err))
-					close(dumpWaitDone)
-					return
+				}
+			case <-syncC:
+				if err := fs.wal.sync(); err != nil {
+					log.Warn("fs.dumpWait(): Couldn't sync wal", zap.Error(err))
 				}
 			case <-cx.Done():
 				log.Debug("dumpWait is done...")
-				close(dumpWaitDone)
 				return
 			}
 		}
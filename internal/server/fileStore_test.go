@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"metrics/internal/service"
+)
+
+func TestWALRestore(t *testing.T) {
+	cx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.json")
+
+	fs, err := NewFileStore(path, 300, WALSyncAlways)
+	if err != nil {
+		t.Fatal(err)
+	}
+	put := func(fs *FileStorage, mtype, id, val string) {
+		met, err := service.NewMetric(mtype, id, val)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = fs.Put(cx, met); err != nil {
+			t.Fatal(err)
+		}
+	}
+	put(fs, "counter", "PollCount", "2")
+	if err = fs.dump(cx); err != nil {
+		t.Fatal(err)
+	}
+	put(fs, "counter", "PollCount", "3")
+	put(fs, "gauge", "Alloc", "1.5")
+	fs.Close() // имитация сбоя: последний снимок не снят
+
+	// оборванная запись в конце журнала
+	f, err := os.OpenFile(path+walSuffix, os.O_APPEND|os.O_WRONLY, permissions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`[{"id":"Alloc","type":"gau`)
+	_ = f.Close()
+
+	restored, err := NewFileStore(path, 300, WALSyncAlways)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	restored.RestoreFromFile(cx)
+	put(restored, "counter", "PollCount", "1")
+
+	pc, err := restored.Get(cx, &service.Metrics{ID: "PollCount", MType: "counter"})
+	if err != nil || *pc.Delta != 6 {
+		t.Errorf("expected PollCount 6, got %v (%v)", pc, err)
+	}
+	alloc, err := restored.Get(cx, &service.Metrics{ID: "Alloc", MType: "gauge"})
+	if err != nil || *alloc.Value != 1.5 {
+		t.Errorf("expected Alloc 1.5, got %v (%v)", alloc, err)
+	}
+	samples, _ := restored.wal.replay()
+	if len(samples) != 3 {
+		t.Errorf("expected 3 valid wal samples, got %d", len(samples))
+	}
+
+	// ошибка журнала не меняет память: повтор запроса не удвоит счетчик
+	_ = restored.wal.file.Close()
+	if _, err = restored.Put(cx, service.BuildMetric("PollCount", int64(4))); err == nil {
+		t.Fatal("expected wal error")
+	}
+	if pc, _ = restored.Get(cx, &service.Metrics{ID: "PollCount", MType: "counter"}); *pc.Delta != 6 {
+		t.Errorf("expected PollCount 6 after failed write, got %d", *pc.Delta)
+	}
+}
+
+func TestSnapshotFallback(t *testing.T) {
+	cx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.json")
+
+	fs, err := NewFileStore(path, 300, WALSyncNo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.Keep = 2
+	for _, val := range []string{"1", "2", "3", "4"} {
+		met, _ := service.NewMetric("gauge", "Alloc", val)
+		_, _ = fs.Put(cx, met)
+		if err = fs.dump(cx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fs.Close()
+	if _, err = os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected only 2 rotated snapshots, stat err: %v", err)
+	}
+	if _, err = os.Stat(path + ".2"); err != nil {
+		t.Errorf("expected rotated snapshot: %v", err)
+	}
+
+	// повреждаем текущий снимок: восстановление должно взять предыдущий
+	b, _ := os.ReadFile(path)
+	if err = os.WriteFile(path, b[:len(b)-10], permissions); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := NewFileStore(path, 300, WALSyncNo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	restored.Keep = 2
+	restored.RestoreFromFile(cx)
+	alloc, err := restored.Get(cx, &service.Metrics{ID: "Alloc", MType: "gauge"})
+	if err != nil || *alloc.Value != 3 {
+		t.Errorf("expected Alloc 3 from previous snapshot, got %v (%v)", alloc, err)
+	}
+}
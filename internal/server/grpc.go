@@ -0,0 +1,131 @@
+package server
+
+import (
+	ctx "context"
+	"errors"
+	"io"
+	"net"
+
+	log "metrics/internal/logger"
+	pb "metrics/internal/proto"
+	sec "metrics/internal/security"
+	s "metrics/internal/service"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	_ "google.golang.org/grpc/encoding/gzip" // сжатые запросы агентов
+	"google.golang.org/grpc/status"
+)
+
+// MetricsService gRPC-транспорт поверх того же Storage, что и HTTP.
+type MetricsService struct {
+	pb.UnimplementedMetricsServer
+	Storage Storage
+}
+
+func metricFromProto(pm *pb.Metric) (*s.Metrics, error) {
+	if pm == nil {
+		return nil, status.Error(codes.InvalidArgument, "empty metric")
+	}
+	met := pm.ToMetric()
+	discardClientTime(met)
+	if err := met.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return met, nil
+}
+
+func (ms *MetricsService) Update(cx ctx.Context, req *pb.UpdateRequest) (*pb.UpdateResponse, error) {
+	met, err := metricFromProto(req.GetMetric())
+	if err != nil {
+		return nil, err
+	}
+	if met, err = ms.Storage.Put(cx, met); err != nil {
+		log.Warn("Update(): couldn't write to store", zap.Error(err))
+		return nil, putError(err)
+	}
+	return &pb.UpdateResponse{Metric: pb.FromMetric(met)}, nil
+}
+
+func (ms *MetricsService) UpdateBatch(cx ctx.Context, req *pb.UpdateBatchRequest) (*pb.UpdateBatchResponse, error) {
+	metrics := make([]*s.Metrics, 0, len(req.GetMetrics()))
+	for _, pm := range req.GetMetrics() {
+		met, err := metricFromProto(pm)
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, met)
+	}
+	if err := ms.Storage.PutBatch(cx, metrics); err != nil {
+		log.Warn("UpdateBatch(): couldn't send the batch", zap.Error(err))
+		return nil, putError(err)
+	}
+	return &pb.UpdateBatchResponse{}, nil
+}
+
+// Stream собирает метрики потока и записывает их одним пакетом
+// после закрытия потока клиентом.
+func (ms *MetricsService) Stream(stream pb.Metrics_StreamServer) error {
+	var metrics []*s.Metrics
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		met, err := metricFromProto(req.GetMetric())
+		if err != nil {
+			return err
+		}
+		metrics = append(metrics, met)
+	}
+	if err := ms.Storage.PutBatch(stream.Context(), metrics); err != nil {
+		log.Warn("Stream(): couldn't send the batch", zap.Error(err))
+		return putError(err)
+	}
+	return stream.SendAndClose(&pb.StreamResponse{Accepted: uint64(len(metrics))})
+}
+
+// putError статус gRPC для ошибки записи, как putStatus для HTTP.
+func putError(err error) error {
+	if invalidPut(err) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func (mm *MetricManager) newGRPCServer() *grpc.Server {
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(log.UnaryServerLog,
+			sec.UnarySubnetInterceptor(mm.Trusted), sec.UnaryHashInterceptor(mm.Key)),
+		grpc.ChainStreamInterceptor(log.StreamServerLog,
+			sec.StreamSubnetInterceptor(mm.Trusted), sec.StreamHashInterceptor(mm.Key)),
+	}
+	if mm.TLSConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(mm.TLSConfig)))
+	}
+	srv := grpc.NewServer(opts...)
+	pb.RegisterMetricsServer(srv, &MetricsService{Storage: mm.Storage})
+	return srv
+}
+
+// serveGRPC работает до отмены контекста, затем дожидается активных вызовов.
+func (mm *MetricManager) serveGRPC(cx ctx.Context, done chan<- struct{}) {
+	defer close(done)
+	lis, err := net.Listen("tcp", mm.GRPCAddr)
+	if err != nil {
+		log.Fatal("grpc listen error", zap.Error(err))
+	}
+	srv := mm.newGRPCServer()
+	go func() {
+		<-cx.Done()
+		srv.GracefulStop()
+	}()
+	if err = srv.Serve(lis); err != nil {
+		log.Warn("grpc serve error", zap.Error(err))
+	}
+}
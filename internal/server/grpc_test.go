@@ -0,0 +1,145 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	c "metrics/internal/compress"
+	pb "metrics/internal/proto"
+	sec "metrics/internal/security"
+	s "metrics/internal/service"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func grpcClient(t *testing.T, mm *MetricManager, key string) pb.MetricsClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := mm.newGRPCServer()
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(c.UnaryClientGzip, sec.UnaryClientHash(key)),
+		grpc.WithChainStreamInterceptor(c.StreamClientGzip, sec.StreamClientHash(key)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewMetricsClient(conn)
+}
+
+func TestGRPCService(t *testing.T) {
+	cx := context.Background()
+	mm := &MetricManager{Storage: NewMemStore(), Key: "secret"}
+	client := grpcClient(t, mm, "secret")
+
+	delta, val := int64(3), 1.5
+	resp, err := client.Update(cx, &pb.UpdateRequest{
+		Metric: &pb.Metric{Id: "PollCount", Type: "counter", Delta: &delta},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetMetric().GetDelta() != 3 {
+		t.Errorf("expected delta 3, got %d", resp.GetMetric().GetDelta())
+	}
+
+	_, err = client.UpdateBatch(cx, &pb.UpdateBatchRequest{Metrics: []*pb.Metric{
+		{Id: "PollCount", Type: "counter", Delta: &delta},
+		{Id: "CPUutilization", Type: "gauge", Value: &val, Labels: map[string]string{"cpu": "1"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := client.Stream(cx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		if err = stream.Send(&pb.UpdateRequest{Metric: &pb.Metric{Id: "PollCount", Type: "counter", Delta: &delta}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.GetAccepted() != 4 {
+		t.Errorf("expected 4 accepted, got %d", res.GetAccepted())
+	}
+
+	met, _ := mm.Get(cx, &s.Metrics{ID: "PollCount", MType: "counter"})
+	if met == nil || *met.Delta != 18 {
+		t.Errorf("expected PollCount 18, got %v", met)
+	}
+	gauge, _ := mm.Get(cx, &s.Metrics{ID: "CPUutilization", MType: "gauge", Labels: map[string]string{"cpu": "1"}})
+	if gauge == nil || *gauge.Value != 1.5 {
+		t.Errorf("expected labeled gauge 1.5, got %v", gauge)
+	}
+}
+
+func TestGRPCSignMismatch(t *testing.T) {
+	cx := context.Background()
+	mm := &MetricManager{Storage: NewMemStore(), Key: "secret"}
+	client := grpcClient(t, mm, "")
+
+	val := 1.0
+	cx = metadata.AppendToOutgoingContext(cx, sec.HashMetadata, "bad")
+	_, err := client.Update(cx, &pb.UpdateRequest{Metric: &pb.Metric{Id: "g", Type: "gauge", Value: &val}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument, got %v", err)
+	}
+
+	stream, err := client.Stream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = stream.Send(&pb.UpdateRequest{Metric: &pb.Metric{Id: "g", Type: "gauge", Value: &val}, Hash: "bad"})
+	if _, err = stream.CloseAndRecv(); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for stream, got %v", err)
+	}
+	if met, _ := mm.Get(context.Background(), &s.Metrics{ID: "g", MType: "gauge"}); met != nil && met.Value != nil {
+		t.Errorf("unsigned metric is stored: %v", met)
+	}
+}
+
+func TestGRPCTrustedSubnet(t *testing.T) {
+	trusted, _ := sec.ParseSubnets("10.0.0.0/8")
+	mm := &MetricManager{Storage: NewMemStore(), Trusted: trusted}
+	client := grpcClient(t, mm, "")
+
+	val := 1.0
+	req := &pb.UpdateRequest{Metric: &pb.Metric{Id: "g", Type: "gauge", Value: &val}}
+	outside := metadata.AppendToOutgoingContext(context.Background(), sec.RealIPMetadata, "172.16.0.1")
+	if _, err := client.Update(outside, req); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected PermissionDenied, got %v", err)
+	}
+	stream, err := client.Stream(outside)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = stream.Send(req)
+	if _, err = stream.CloseAndRecv(); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected PermissionDenied for stream, got %v", err)
+	}
+	// без x-real-ip проверяется адрес соединения, у bufconn его нет
+	if _, err = client.Update(context.Background(), req); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected PermissionDenied without real ip, got %v", err)
+	}
+
+	inside := metadata.AppendToOutgoingContext(context.Background(), sec.RealIPMetadata, "10.1.2.3")
+	if _, err = client.Update(inside, req); err != nil {
+		t.Errorf("expected trusted client to pass, got %v", err)
+	}
+}
@@ -5,9 +5,13 @@ import (
 	"errors"
 	"io"
 	"net/http"
+	"net/netip"
+	"slices"
 	"strconv"
+	"time"
 
 	log "metrics/internal/logger"
+	sec "metrics/internal/security"
 	s "metrics/internal/service"
 
 	"github.com/go-chi/chi/v5"
@@ -25,32 +29,127 @@ type Storage interface {
 	Put(ctx.Context, *s.Metrics) (*s.Metrics, error)
 	Get(ctx.Context, *s.Metrics) (*s.Metrics, error)
 	List(ctx.Context) ([]*s.Metrics, error)
+	ListPage(ctx.Context, *ListFilter) ([]*s.Metrics, error)
 	PutBatch(ctx.Context, []*s.Metrics) error
+	Range(ctx.Context, *s.Metrics, time.Time, time.Time) ([]*s.Metrics, error)
 	Close()
 }
 
 type MetricManager struct {
 	Storage
 	http.Server
+	StatsdAddr string
+	GRPCAddr   string
+	Key        string
+	Buckets    []float64      // корзины гистограмм из одиночных наблюдений; nil — s.DefaultBuckets
+	Trusted    []netip.Prefix // подсети, которым разрешена запись по gRPC; пусто — всем
+
+	ScrapeTargets  []string
+	ScrapeFile     string
+	ScrapeInterval time.Duration
+
+	AlertRules    []*Rule
+	AlertInterval time.Duration
+	alerts        *alertEngine
+
+	Webhooks        []string
+	NotifyGroupBy   []string
+	NotifyGroupWait time.Duration
+	NotifyRepeat    time.Duration
+	silences        *silences
+
+	stream *streamHub
 }
 
 func (mm *MetricManager) Run(cx ctx.Context) {
+	if st, ok := mm.Storage.(interface{ setBuckets([]float64) }); ok {
+		st.setBuckets(mm.Buckets)
+	}
+	// до запуска http-сервера: обработчики читают mm.alerts, mm.silences
+	// и mm.stream без блокировки; без правил тишины не принимаются
+	mm.EnableStream()
+	alertsDone, notifyDone := make(chan struct{}), make(chan struct{})
+	if len(mm.AlertRules) > 0 {
+		mm.silences = newSilences()
+		mm.alerts = newAlertEngine(mm)
+		if len(mm.Webhooks) > 0 {
+			mm.alerts.notifier = newNotifier(mm)
+			go mm.alerts.notifier.run(cx, notifyDone)
+		} else {
+			close(notifyDone)
+		}
+		go mm.alerts.run(cx, alertsDone)
+	} else {
+		close(alertsDone)
+		close(notifyDone)
+	}
+
 	errChan := make(chan error, 1)
 	go func() {
-		err := mm.ListenAndServe()
+		var err error
+		if mm.TLSConfig != nil {
+			err = mm.ListenAndServeTLS("", "")
+		} else {
+			err = mm.ListenAndServe()
+		}
 		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			errChan <- err
 		}
 		close(errChan)
 	}()
 
+	statsdDone := make(chan struct{})
+	if mm.StatsdAddr != "" {
+		statsd, err := newStatsdListener(mm.StatsdAddr, mm.Storage)
+		if err != nil {
+			log.Fatal("statsd listener error", zap.Error(err))
+		}
+		go statsd.serve(cx, statsdDone)
+	} else {
+		close(statsdDone)
+	}
+
+	scrapeDone := make(chan struct{})
+	if len(mm.ScrapeTargets) > 0 || mm.ScrapeFile != "" {
+		go newScraper(mm).run(cx, scrapeDone)
+	} else {
+		close(scrapeDone)
+	}
+
+	grpcDone := make(chan struct{})
+	if mm.GRPCAddr != "" {
+		go mm.serveGRPC(cx, grpcDone)
+	} else {
+		close(grpcDone)
+	}
+
+	retentionDone, partitionsDone := make(chan struct{}), make(chan struct{})
+	db, isDB := baseStorage(mm.Storage).(*DataBase)
+	if isDB && db.Retention != nil {
+		go db.runRetention(cx, retentionDone)
+	} else {
+		close(retentionDone)
+	}
+	if isDB {
+		go db.runPartitions(cx, partitionsDone)
+	} else {
+		close(partitionsDone)
+	}
+
 	dumpWaitDone := make(chan struct{})
-	fileStore, isFileStore := mm.Storage.(*FileStorage)
+	fileStore, isFileStore := baseStorage(mm.Storage).(*FileStorage)
 	if isFileStore {
 		fileStore.dumpWait(cx, dumpWaitDone)
 	}
 	select {
 	case <-cx.Done():
+		<-statsdDone
+		<-grpcDone
+		<-scrapeDone
+		<-retentionDone
+		<-partitionsDone
+		<-alertsDone
+		<-notifyDone
 		if isFileStore {
 			if err := fileStore.dump(cx); err != nil {
 				log.Warn("couldn't dump to file", zap.Error(err))
@@ -66,10 +165,7 @@ func (mm *MetricManager) Run(cx ctx.Context) {
 }
 
 func (mm *MetricManager) UpdateHandler(rw http.ResponseWriter, req *http.Request) {
-	metric, err := s.NewMetric(
-		chi.URLParam(req, mtype),
-		chi.URLParam(req, id),
-		chi.URLParam(req, value))
+	metric, err := metricFromURL(req, chi.URLParam(req, value))
 	if err != nil {
 		log.Warn("NewMetric error", zap.Error(err))
 		http.Error(rw, err.Error(), http.StatusBadRequest)
@@ -77,21 +173,22 @@ func (mm *MetricManager) UpdateHandler(rw http.ResponseWriter, req *http.Request
 	}
 	if _, err = mm.Put(req.Context(), metric); err != nil {
 		log.Warn("UpdateHandler(): storage error", zap.Error(err))
-		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		http.Error(rw, err.Error(), putStatus(err))
 		return
 	}
 	rw.WriteHeader(http.StatusOK)
 }
 
 func (mm *MetricManager) GetHandler(rw http.ResponseWriter, req *http.Request) {
-	met, err := s.NewMetric(
-		chi.URLParam(req, mtype),
-		chi.URLParam(req, id),
-		"")
+	met, err := metricFromURL(req, "")
 	if errors.Is(s.ErrInvalidType, err) {
 		log.Warn("GetHandler()", zap.Error(err))
 		http.Error(rw, err.Error(), http.StatusNotFound)
 		return
+	} else if err != nil {
+		log.Warn("GetHandler()", zap.Error(err))
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
 	}
 	metric, err := mm.Get(req.Context(), met)
 	if errors.Is(err, ErrConnDB) {
@@ -104,9 +201,13 @@ func (mm *MetricManager) GetHandler(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 	var numStr string
-	if metric.IsCounter() {
+	switch {
+	case metric.IsCounter():
 		numStr = strconv.FormatInt(*metric.Delta, 10)
-	} else {
+	case metric.IsHistogram():
+		b, _ := metric.Hist.MarshalJSON()
+		numStr = string(b)
+	default:
 		numStr = strconv.FormatFloat(*metric.Value, 'f', -1, 64)
 	}
 	rw.WriteHeader(http.StatusOK)
@@ -135,6 +236,58 @@ func (mm *MetricManager) GetAllHandler(rw http.ResponseWriter, req *http.Request
 	_, _ = rw.Write(html.Bytes())
 }
 
+// ListJSONHandler метрики JSON-массивом с отбором, сортировкой и постраничной
+// выдачей (см. parseListFilter). Курсор следующей страницы — в NextCursorHeader.
+func (mm *MetricManager) ListJSONHandler(rw http.ResponseWriter, req *http.Request) {
+	filter, err := parseListFilter(req.URL.Query())
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	metrics, err := mm.ListPage(req.Context(), filter)
+	if err != nil {
+		log.Warn("ListJSONHandler(): storage error", zap.Error(err))
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if metrics == nil {
+		metrics = []*s.Metrics{}
+	}
+	data, err := ffjson.Marshal(metrics)
+	if err != nil {
+		log.Warn("ListJSONHandler(): marshal error", zap.Error(err))
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if filter.Limit > 0 && len(metrics) == filter.Limit {
+		rw.Header().Set(NextCursorHeader, encodeCursor(metrics[len(metrics)-1]))
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(data)
+}
+
+// RootHandler список метрик: JSON, если клиент предпочитает application/json, иначе HTML.
+func (mm *MetricManager) RootHandler(rw http.ResponseWriter, req *http.Request) {
+	if prefersJSON(req.Header.Get("Accept")) {
+		mm.ListJSONHandler(rw, req)
+		return
+	}
+	mm.GetAllHandler(rw, req)
+}
+
+func (mm *MetricManager) PrometheusHandler(rw http.ResponseWriter, req *http.Request) {
+	metrics, err := mm.List(req.Context())
+	if err != nil {
+		log.Warn("PrometheusHandler(): storage error", zap.Error(err))
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", promContentType)
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(renderPrometheus(metrics).Bytes())
+}
+
 func (mm *MetricManager) UpdateJSON(rw http.ResponseWriter, req *http.Request) {
 	log.Debug("UpdateJSON...")
 	bytes, err := io.ReadAll(req.Body)
@@ -145,9 +298,15 @@ func (mm *MetricManager) UpdateJSON(rw http.ResponseWriter, req *http.Request) {
 
 	metric := &s.Metrics{}
 	_ = metric.UnmarshalJSON(bytes)
+	discardClientTime(metric)
+	if err = metric.Validate(); err != nil {
+		log.Warn("UpdateJSON(): invalid metric", zap.Error(err))
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if metric, err = mm.Put(req.Context(), metric); err != nil {
 		log.Warn("UpdateJSON(): couldn't write to store", zap.Error(err))
-		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		http.Error(rw, err.Error(), putStatus(err))
 		return
 	}
 	bytes, _ = metric.MarshalJSON()
@@ -183,7 +342,7 @@ func (mm *MetricManager) GetJSON(rw http.ResponseWriter, req *http.Request) {
 }
 
 func (mm *MetricManager) PingHandler(rw http.ResponseWriter, req *http.Request) {
-	if db, ok := mm.Storage.(*DataBase); ok {
+	if db, ok := baseStorage(mm.Storage).(*DataBase); ok {
 		if err := db.Ping(req.Context()); err != nil {
 			log.Warn("ping error", zap.Error(err))
 			http.Error(rw, err.Error(), http.StatusInternalServerError)
@@ -210,10 +369,170 @@ func (mm *MetricManager) BatchHandler(rw http.ResponseWriter, req *http.Request)
 		http.Error(rw, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	metrics = slices.DeleteFunc(metrics, func(met *s.Metrics) bool { return met == nil })
+	discardClientTime(metrics...)
+	for _, met := range metrics {
+		if err = met.Validate(); err != nil {
+			log.Warn("BatchHandler(): invalid metric", zap.Error(err))
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 	if err = mm.PutBatch(req.Context(), metrics); err != nil {
 		log.Warn("UpdatesJSON(): couldn't send the batch", zap.Error(err))
 		http.Error(rw, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if peer := sec.PeerFromContext(req.Context()); peer != "" {
+		log.Info("batch accepted", zap.String("peer", peer), zap.Int("size", len(metrics)))
+	}
+	rw.WriteHeader(http.StatusOK)
+}
+
+func (mm *MetricManager) QueryHandler(rw http.ResponseWriter, req *http.Request) {
+	met, err := metricFromURL(req, "")
+	if errors.Is(s.ErrInvalidType, err) {
+		log.Warn("QueryHandler()", zap.Error(err))
+		http.Error(rw, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Warn("QueryHandler()", zap.Error(err))
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query, err := parseRangeQuery(met, req.URL.Query())
+	if err != nil {
+		log.Warn("QueryHandler(): bad query", zap.Error(err))
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	samples, err := mm.Range(req.Context(), met, query.from, query.to)
+	if errors.Is(err, ErrNoValue) {
+		log.Warn("QueryHandler(): no such metric in store", zap.Error(err))
+		http.Error(rw, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Warn("QueryHandler(): storage error", zap.Error(err))
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	bytes, err := ffjson.Marshal(QueryResult{
+		ID:     met.ID,
+		MType:  met.MType,
+		Labels: met.Labels,
+		Agg:    query.agg,
+		From:   query.from.UnixMilli(),
+		To:     query.to.UnixMilli(),
+		Step:   query.step.Milliseconds(),
+		Points: aggregate(samples, query),
+	})
+	if err != nil {
+		log.Warn("QueryHandler(): marshal error", zap.Error(err))
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(bytes)
+}
+
+// AlertsHandler оповещения JSON-массивом; параметр state отбирает по состоянию.
+func (mm *MetricManager) AlertsHandler(rw http.ResponseWriter, req *http.Request) {
+	alerts := []*Alert{}
+	if mm.alerts != nil {
+		alerts = mm.alerts.list(req.URL.Query().Get("state"))
+	}
+	bytes, err := ffjson.Marshal(alerts)
+	if err != nil {
+		log.Warn("AlertsHandler(): marshal error", zap.Error(err))
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(bytes)
+}
+
+// SilencesHandler действующие и будущие тишины JSON-массивом.
+func (mm *MetricManager) SilencesHandler(rw http.ResponseWriter, req *http.Request) {
+	list := []*Silence{}
+	if mm.silences != nil {
+		list = mm.silences.list(time.Now())
+	}
+	bytes, err := ffjson.Marshal(list)
+	if err != nil {
+		log.Warn("SilencesHandler(): marshal error", zap.Error(err))
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
 	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(bytes)
+}
+
+// AddSilenceHandler заводит тишину и отвечает ею же с присвоенным id.
+func (mm *MetricManager) AddSilenceHandler(rw http.ResponseWriter, req *http.Request) {
+	if mm.silences == nil {
+		http.Error(rw, "alert rules are not configured", http.StatusServiceUnavailable)
+		return
+	}
+	b, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer req.Body.Close()
+
+	var sl Silence
+	if err = ffjson.Unmarshal(b, &sl); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	added, err := mm.silences.add(&sl, time.Now())
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	bytes, err := ffjson.Marshal(added)
+	if err != nil {
+		log.Warn("AddSilenceHandler(): marshal error", zap.Error(err))
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusCreated)
+	_, _ = rw.Write(bytes)
+}
+
+func (mm *MetricManager) DeleteSilenceHandler(rw http.ResponseWriter, req *http.Request) {
+	if mm.silences == nil || mm.silences.remove(chi.URLParam(req, "id")) != nil {
+		http.Error(rw, ErrNoSilence.Error(), http.StatusNotFound)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func (mm *MetricManager) WriteHandler(rw http.ResponseWriter, req *http.Request) {
+	log.Debug("WriteHandler...")
+	defer req.Body.Close()
+	precision, err := influxPrecision(req.URL.Query().Get("precision"))
+	if err != nil {
+		log.Warn("WriteHandler(): bad precision", zap.Error(err))
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	metrics, err := parseInflux(req.Body, precision)
+	if err != nil {
+		log.Warn("WriteHandler(): parse error", zap.Error(err))
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(metrics) > 0 {
+		if err = mm.PutBatch(req.Context(), metrics); err != nil {
+			log.Warn("WriteHandler(): couldn't write the batch", zap.Error(err))
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	rw.WriteHeader(http.StatusNoContent)
 }
@@ -1,9 +1,13 @@
 package server
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestHandlers(t *testing.T) {
@@ -62,3 +66,28 @@ func TestHandlers(t *testing.T) {
 		log.Println("\n\nTEST NAME:", test.name)
 	}
 }
+
+func TestClientTimeDiscarded(t *testing.T) {
+	mm := &MetricManager{Storage: NewMemStore()}
+	before := time.Now().UnixMilli()
+	reqs := []struct {
+		handler http.HandlerFunc
+		body    string
+	}{
+		{mm.UpdateJSON, `{"id":"a","type":"gauge","value":1,"timestamp":1000}`},
+		{mm.BatchHandler, `[{"id":"b","type":"counter","delta":1,"timestamp":4102444800000}]`},
+	}
+	for _, r := range reqs {
+		rec := httptest.NewRecorder()
+		r.handler(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(r.body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("unexpected status %d for %s", rec.Code, r.body)
+		}
+	}
+	metrics, _ := mm.List(context.Background())
+	for _, met := range metrics {
+		if met.Timestamp < before || met.Timestamp > time.Now().UnixMilli() {
+			t.Errorf("%s: expected server receive time, got %d", met.ID, met.Timestamp)
+		}
+	}
+}
@@ -1,7 +1,15 @@
 package server
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
 	s "metrics/internal/service"
+
+	"github.com/go-chi/chi/v5"
 )
 
 func getQuery(oper dbOperation, met *s.Metrics) string {
@@ -11,6 +19,11 @@ func getQuery(oper dbOperation, met *s.Metrics) string {
 			return insertGauge
 		}
 		return insertCounter
+	case selectRange:
+		if met.IsGauge() {
+			return rangeGauge
+		}
+		return rangeCounter
 	default:
 		if met.IsGauge() {
 			return selectGauge
@@ -27,3 +40,92 @@ func setVal(met *s.Metrics, val any) {
 		met.Value = &v
 	}
 }
+
+// labelSet возвращает метки для сравнения в БД: отсутствие меток хранится как '{}'.
+func labelSet(met *s.Metrics) map[string]string {
+	if met.Labels == nil {
+		return map[string]string{}
+	}
+	return met.Labels
+}
+
+// metricFromURL собирает метрику из параметров пути {type}/{id}
+// и меток из параметра запроса labels=k1=v1,k2=v2.
+func metricFromURL(req *http.Request, val string) (*s.Metrics, error) {
+	met, err := s.NewMetric(chi.URLParam(req, mtype), chi.URLParam(req, id), val)
+	if err != nil {
+		return nil, err
+	}
+	if met.Labels, err = s.ParseLabels(req.URL.Query().Get("labels")); err != nil {
+		return nil, err
+	}
+	return met, nil
+}
+
+// compareMetrics порядок метрик: тип, имя, метки.
+func compareMetrics(a, b *s.Metrics) int {
+	if c := strings.Compare(a.MType, b.MType); c != 0 {
+		return c
+	}
+	if c := strings.Compare(a.ID, b.ID); c != 0 {
+		return c
+	}
+	return strings.Compare(a.LabelString(), b.LabelString())
+}
+
+// prefersJSON сравнивает веса application/json и text/html в заголовке Accept.
+// При равных весах выбирается HTML: браузеры перечисляют оба типа.
+func prefersJSON(accept string) bool {
+	var jsonQ, htmlQ float64
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		for _, p := range strings.Split(params, ";") {
+			if name, val, ok := strings.Cut(strings.TrimSpace(p), "="); ok && name == "q" {
+				q, _ = strconv.ParseFloat(val, 64)
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(mediaType)) {
+		case "application/json":
+			jsonQ = max(jsonQ, q)
+		case "text/html", "text/*":
+			htmlQ = max(htmlQ, q)
+		}
+	}
+	return jsonQ > htmlQ
+}
+
+// discardClientTime время сэмпла назначает сервер при приеме: метка клиента
+// позволила бы записать сэмпл задним числом, мимо уже свернутой истории.
+// Время из запроса принимает только протокол Influx, где оно часть строки.
+func discardClientTime(mets ...*s.Metrics) {
+	for _, met := range mets {
+		met.Timestamp = 0
+	}
+}
+
+// putStatus код ответа на ошибку записи: несовпадение корзин гистограммы
+// и метрика без значения или с неизвестным типом — ошибка клиента,
+// остальное — ошибка хранилища.
+func putStatus(err error) int {
+	if invalidPut(err) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func invalidPut(err error) bool {
+	return errors.Is(err, s.ErrHistBounds) || errors.Is(err, s.ErrInvalidType) || errors.Is(err, ErrNoValue)
+}
+
+// checkPut проверяет тип и наличие значения метрики до записи в БД.
+func checkPut(met *s.Metrics) error {
+	switch {
+	case met.IsGauge() && met.Value == nil, met.IsCounter() && met.Delta == nil,
+		met.IsHistogram() && met.Hist == nil && met.Value == nil:
+		return fmt.Errorf("%w: %s", ErrNoValue, met.Key())
+	case !met.IsGauge() && !met.IsCounter() && !met.IsHistogram():
+		return fmt.Errorf("%w: %q", s.ErrInvalidType, met.MType)
+	}
+	return nil
+}
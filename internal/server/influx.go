@@ -0,0 +1,179 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	s "metrics/internal/service"
+)
+
+var ErrInfluxLine = errors.New("invalid line protocol")
+
+// influxPrecision переводит параметр precision в длительность единицы метки времени.
+func influxPrecision(p string) (time.Duration, error) {
+	switch p {
+	case "", "ns", "n":
+		return time.Nanosecond, nil
+	case "us", "u":
+		return time.Microsecond, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "s":
+		return time.Second, nil
+	}
+	return 0, fmt.Errorf("%w: unknown precision %q", ErrInfluxLine, p)
+}
+
+// parseInflux разбирает тело запроса в формате InfluxDB line protocol.
+// Каждое числовое поле становится отдельной метрикой measurement_field:
+// целые поля (5i, 5u) — counter, дробные — gauge; беззнаковое значение больше
+// MaxInt64 не помещается в приращение и пишется как gauge. Строки и логические
+// значения пропускаются. Теги становятся метками.
+func parseInflux(r io.Reader, precision time.Duration) ([]*s.Metrics, error) {
+	var mets []*s.Metrics
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		lineMets, err := parseInfluxLine(line, precision)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		mets = append(mets, lineMets...)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read line protocol: %w", err)
+	}
+	return mets, nil
+}
+
+func parseInfluxLine(line string, precision time.Duration) ([]*s.Metrics, error) {
+	sections := splitInflux(line, ' ')
+	if len(sections) < 2 || len(sections) > 3 {
+		return nil, ErrInfluxLine
+	}
+	keys := splitInflux(sections[0], ',')
+	measurement := unescapeInflux(keys[0])
+	if measurement == "" {
+		return nil, fmt.Errorf("%w: empty measurement", ErrInfluxLine)
+	}
+	var labels map[string]string
+	if len(keys) > 1 {
+		labels = make(map[string]string, len(keys)-1)
+		for _, tag := range keys[1:] {
+			k, v, err := splitInfluxPair(tag)
+			if err != nil {
+				return nil, err
+			}
+			labels[k] = v
+		}
+	}
+	var ts int64
+	if len(sections) == 3 {
+		raw, err := strconv.ParseInt(sections[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad timestamp %q", ErrInfluxLine, sections[2])
+		}
+		if unit := int64(precision); raw > math.MaxInt64/unit || raw < math.MinInt64/unit {
+			return nil, fmt.Errorf("%w: timestamp %q out of range", ErrInfluxLine, sections[2])
+		}
+		ts = time.Unix(0, raw*int64(precision)).UnixMilli()
+	}
+
+	fields := splitInflux(sections[1], ',')
+	mets := make([]*s.Metrics, 0, len(fields))
+	for _, field := range fields {
+		k, v, err := splitInfluxPair(field)
+		if err != nil {
+			return nil, err
+		}
+		met := &s.Metrics{ID: measurement + "_" + k, Labels: labels, Timestamp: ts}
+		switch last := v[len(v)-1]; {
+		case v[0] == '"' || isInfluxBool(v):
+			continue
+		case last == 'i':
+			delta, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: bad integer %q", ErrInfluxLine, v)
+			}
+			met.MType = "counter"
+			met.Delta = &delta
+		case last == 'u':
+			num, err := strconv.ParseUint(v[:len(v)-1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: bad unsigned integer %q", ErrInfluxLine, v)
+			}
+			if num > math.MaxInt64 {
+				val := float64(num)
+				met.MType = "gauge"
+				met.Value = &val
+				break
+			}
+			delta := int64(num)
+			met.MType = "counter"
+			met.Delta = &delta
+		default:
+			val, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: bad float %q", ErrInfluxLine, v)
+			}
+			met.MType = "gauge"
+			met.Value = &val
+		}
+		mets = append(mets, met)
+	}
+	return mets, nil
+}
+
+func isInfluxBool(v string) bool {
+	switch v {
+	case "t", "T", "true", "True", "TRUE", "f", "F", "false", "False", "FALSE":
+		return true
+	}
+	return false
+}
+
+func splitInfluxPair(pair string) (string, string, error) {
+	parts := splitInflux(pair, '=')
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("%w: bad pair %q", ErrInfluxLine, pair)
+	}
+	return unescapeInflux(parts[0]), unescapeInflux(parts[1]), nil
+}
+
+// splitInflux делит строку по sep, пропуская экранированные символы
+// и содержимое строк в двойных кавычках.
+func splitInflux(str string, sep byte) []string {
+	var parts []string
+	start, quoted := 0, false
+	for i := 0; i < len(str); i++ {
+		switch c := str[i]; {
+		case c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case c == sep && !quoted:
+			parts = append(parts, str[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, str[start:])
+}
+
+var influxUnescaper = strings.NewReplacer(`\,`, ",", `\=`, "=", `\ `, " ", `\"`, `"`, `\\`, `\`)
+
+func unescapeInflux(str string) string {
+	if !strings.Contains(str, `\`) {
+		return str
+	}
+	return influxUnescaper.Replace(str)
+}
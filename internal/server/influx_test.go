@@ -0,0 +1,54 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseInflux(t *testing.T) {
+	body := `# comment
+cpu,host=srv\ 1,region=eu usage_idle=92.5,procs=12i,running=true,state="ok, fine" 1700000000000000000
+
+mem used=1024u,free=2.5e3
+`
+	mets, err := parseInflux(strings.NewReader(body), time.Nanosecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mets) != 4 {
+		t.Fatalf("expected 4 metrics, got %d", len(mets))
+	}
+	idle, procs, used, free := mets[0], mets[1], mets[2], mets[3]
+	if idle.ID != "cpu_usage_idle" || !idle.IsGauge() || *idle.Value != 92.5 {
+		t.Errorf("unexpected gauge: %+v", idle)
+	}
+	if idle.Labels["host"] != "srv 1" || idle.Labels["region"] != "eu" {
+		t.Errorf("unexpected labels: %v", idle.Labels)
+	}
+	if idle.Timestamp != 1700000000000 {
+		t.Errorf("unexpected timestamp: %d", idle.Timestamp)
+	}
+	if procs.ID != "cpu_procs" || !procs.IsCounter() || *procs.Delta != 12 {
+		t.Errorf("unexpected counter: %+v", procs)
+	}
+	if !used.IsCounter() || *used.Delta != 1024 || used.Timestamp != 0 {
+		t.Errorf("unexpected counter: %+v", used)
+	}
+
+	// беззнаковое больше MaxInt64 не отклоняется
+	big, err := parseInflux(strings.NewReader("disk total=18446744073709551615u"), time.Nanosecond)
+	if err != nil || len(big) != 1 || !big[0].IsGauge() || *big[0].Value != 18446744073709551615 {
+		t.Errorf("unexpected large unsigned field: %v (%v)", big, err)
+	}
+	if !free.IsGauge() || *free.Value != 2500 {
+		t.Errorf("unexpected gauge: %+v", free)
+	}
+
+	for _, bad := range []string{"cpu", "cpu value=abc", "cpu value=1 notatime", "cpu,host value=1", "cpu value=1x1i", "cpu value=-1u",
+		"cpu value=1 9223372036854775"} {
+		if _, err := parseInflux(strings.NewReader(bad), time.Millisecond); err == nil {
+			t.Errorf("%q: expected error", bad)
+		}
+	}
+}
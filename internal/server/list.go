@@ -0,0 +1,183 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	s "metrics/internal/service"
+)
+
+const (
+	sortByType = "type"
+	sortByID   = "id"
+
+	maxListLimit = 10000
+
+	// NextCursorHeader курсор следующей страницы; отсутствует на последней странице.
+	NextCursorHeader = "X-Next-Cursor"
+)
+
+// ListFilter отбор, порядок и страница метрик для ListPage.
+type ListFilter struct {
+	Types   []string
+	Prefix  string         // префикс имени
+	Pattern *regexp.Regexp // glob или регулярное выражение для имени
+	SortBy  string         // type (тип, имя, метки) или id (имя, тип, метки)
+	Desc    bool
+	Limit   int         // 0 — без ограничения
+	After   *ListCursor // nil — с начала
+}
+
+// ListCursor позиция последней метрики отданной страницы.
+type ListCursor struct {
+	Labels map[string]string `json:"l,omitempty"`
+	ID     string            `json:"i"`
+	MType  string            `json:"t"`
+}
+
+// parseListFilter разбирает параметры type (через запятую или повтором),
+// prefix, glob, regex, sort (type, id, -type, -id), limit и cursor.
+func parseListFilter(vals url.Values) (*ListFilter, error) {
+	f := &ListFilter{SortBy: sortByType, Prefix: vals.Get("prefix")}
+	for _, v := range vals["type"] {
+		for _, mtype := range strings.Split(v, ",") {
+			met := &s.Metrics{MType: mtype}
+			if !met.IsGauge() && !met.IsCounter() && !met.IsHistogram() {
+				return nil, fmt.Errorf("%w: type %q", ErrInvalidQuery, mtype)
+			}
+			f.Types = append(f.Types, mtype)
+		}
+	}
+
+	glob, expr := vals.Get("glob"), vals.Get("regex")
+	if glob != "" && expr != "" {
+		return nil, fmt.Errorf("%w: glob and regex are mutually exclusive", ErrInvalidQuery)
+	}
+	if glob != "" {
+		expr = globToRegex(glob)
+	}
+	if expr != "" {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: regex: %w", ErrInvalidQuery, err)
+		}
+		f.Pattern = re
+	}
+
+	if v := vals.Get("sort"); v != "" {
+		f.Desc = strings.HasPrefix(v, "-")
+		f.SortBy = strings.TrimPrefix(v, "-")
+		if f.SortBy != sortByType && f.SortBy != sortByID {
+			return nil, fmt.Errorf("%w: sort %q", ErrInvalidQuery, v)
+		}
+	}
+	if v := vals.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > maxListLimit {
+			return nil, fmt.Errorf("%w: limit must be in [1, %d]", ErrInvalidQuery, maxListLimit)
+		}
+		f.Limit = limit
+	}
+	if v := vals.Get("cursor"); v != "" {
+		cur, err := decodeCursor(v)
+		if err != nil {
+			return nil, fmt.Errorf("%w: cursor", ErrInvalidQuery)
+		}
+		f.After = cur
+	}
+	return f, nil
+}
+
+// globToRegex переводит glob (*, ?, [...]) в регулярное выражение на все имя.
+func globToRegex(glob string) string {
+	var b strings.Builder
+	b.WriteByte('^')
+	inClass := false
+	for _, r := range glob {
+		switch {
+		case inClass:
+			if r == ']' {
+				inClass = false
+			}
+			b.WriteRune(r)
+		case r == '*':
+			b.WriteString(".*")
+		case r == '?':
+			b.WriteByte('.')
+		case r == '[':
+			inClass = true
+			b.WriteRune(r)
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteByte('$')
+	return b.String()
+}
+
+func encodeCursor(met *s.Metrics) string {
+	data, _ := json.Marshal(ListCursor{MType: met.MType, ID: met.ID, Labels: met.Labels})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(str string) (*ListCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(str)
+	if err != nil {
+		return nil, err
+	}
+	cur := &ListCursor{}
+	if err = json.Unmarshal(data, cur); err != nil {
+		return nil, err
+	}
+	return cur, nil
+}
+
+// Match проверяет тип и имя метрики.
+func (f *ListFilter) Match(met *s.Metrics) bool {
+	if len(f.Types) > 0 && !slices.Contains(f.Types, met.MType) {
+		return false
+	}
+	if !strings.HasPrefix(met.ID, f.Prefix) {
+		return false
+	}
+	return f.Pattern == nil || f.Pattern.MatchString(met.ID)
+}
+
+func (f *ListFilter) compare(a, b *s.Metrics) int {
+	c := compareMetrics(a, b)
+	if f.SortBy == sortByID {
+		if c = strings.Compare(a.ID, b.ID); c == 0 {
+			c = compareMetrics(a, b)
+		}
+	}
+	if f.Desc {
+		return -c
+	}
+	return c
+}
+
+// apply отбирает, упорядочивает и обрезает метрики по фильтру
+// на стороне приложения: для хранилищ в памяти.
+func (f *ListFilter) apply(metrics []*s.Metrics) []*s.Metrics {
+	var after *s.Metrics
+	if f.After != nil {
+		after = &s.Metrics{MType: f.After.MType, ID: f.After.ID, Labels: f.After.Labels}
+	}
+	res := make([]*s.Metrics, 0, len(metrics))
+	for _, met := range metrics {
+		if met != nil && f.Match(met) && (after == nil || f.compare(met, after) > 0) {
+			res = append(res, met)
+		}
+	}
+	slices.SortFunc(res, f.compare)
+	if f.Limit > 0 && len(res) > f.Limit {
+		res = res[:f.Limit]
+	}
+	return res
+}
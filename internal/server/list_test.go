@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"metrics/internal/service"
+
+	"github.com/pquerna/ffjson/ffjson"
+)
+
+func TestListFilter(t *testing.T) {
+	ms := NewMemStore()
+	for _, id := range []string{"HeapAlloc", "HeapSys", "Alloc", "GCSys"} {
+		_, _ = ms.Put(context.Background(), service.BuildMetric(id, float64(1)))
+	}
+	_, _ = ms.Put(context.Background(), service.BuildMetric("PollCount", int64(1)))
+
+	tests := []struct {
+		query    string
+		expected []string
+		wantErr  bool
+	}{
+		{query: "", expected: []string{"PollCount", "Alloc", "GCSys", "HeapAlloc", "HeapSys"}},
+		{query: "type=gauge&prefix=Heap", expected: []string{"HeapAlloc", "HeapSys"}},
+		{query: "glob=*Sys", expected: []string{"GCSys", "HeapSys"}},
+		{query: "regex=^(Alloc|Poll)", expected: []string{"PollCount", "Alloc"}},
+		{query: "sort=-id&type=gauge,counter", expected: []string{"PollCount", "HeapSys", "HeapAlloc", "GCSys", "Alloc"}},
+		{query: "type=summary", wantErr: true},
+		{query: "glob=a*&regex=b", wantErr: true},
+		{query: "limit=0", wantErr: true},
+		{query: "cursor=not-json", wantErr: true},
+	}
+	for _, test := range tests {
+		vals, _ := url.ParseQuery(test.query)
+		f, err := parseListFilter(vals)
+		if (err != nil) != test.wantErr {
+			t.Fatalf("%q: unexpected error %v", test.query, err)
+		}
+		if err != nil {
+			continue
+		}
+		got, _ := ms.ListPage(context.Background(), f)
+		if ids := metricIDs(got); strings.Join(ids, ",") != strings.Join(test.expected, ",") {
+			t.Errorf("%q: expected %v, got %v", test.query, test.expected, ids)
+		}
+	}
+}
+
+func TestListPagination(t *testing.T) {
+	ms := NewMemStore()
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		_, _ = ms.Put(context.Background(), service.BuildMetric(id, float64(1)))
+	}
+	mm := &MetricManager{Storage: ms}
+
+	var ids []string
+	cursor := ""
+	for pages := 0; pages < 5; pages++ {
+		req := httptest.NewRequest(http.MethodGet, "/values/?limit=2&cursor="+cursor, http.NoBody)
+		rw := httptest.NewRecorder()
+		mm.ListJSONHandler(rw, req)
+		if rw.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rw.Code)
+		}
+		var page []*service.Metrics
+		if err := ffjson.Unmarshal(rw.Body.Bytes(), &page); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, metricIDs(page)...)
+		if cursor = rw.Header().Get(NextCursorHeader); cursor == "" {
+			break
+		}
+	}
+	if strings.Join(ids, ",") != "a,b,c,d,e" {
+		t.Errorf("expected all metrics once, got %v", ids)
+	}
+}
+
+func TestPrefersJSON(t *testing.T) {
+	tests := map[string]bool{
+		"":                 false,
+		"application/json": true,
+		"text/html,application/xhtml+xml,*/*;q=0.8": false,
+		"text/html;q=0.5, application/json":         true,
+		"application/json;q=0, */*":                 false,
+	}
+	for accept, expected := range tests {
+		if got := prefersJSON(accept); got != expected {
+			t.Errorf("%q: expected %v, got %v", accept, expected, got)
+		}
+	}
+}
+
+func TestBuildListQuery(t *testing.T) {
+	vals, _ := url.ParseQuery("type=counter&prefix=a_b&sort=-id&limit=10")
+	f, _ := parseListFilter(vals)
+	f.After = &ListCursor{MType: "counter", ID: "x"}
+	query, args := buildListQuery(f)
+	for _, part := range []string{"FROM counter", "id LIKE $1",
+		"(id, type, labels) < ($2::TEXT, $3::TEXT, $4::JSONB)",
+		"ORDER BY id DESC, type DESC, labels DESC", "LIMIT $5"} {
+		if !strings.Contains(query, part) {
+			t.Errorf("expected %q in query %s", part, query)
+		}
+	}
+	if strings.Contains(query, "FROM gauge") || len(args) != 5 || args[0] != `a\_b%` || args[1] != "x" {
+		t.Errorf("unexpected query %s with args %v", query, args)
+	}
+
+	// шаблон имени проверяется в Go, лимит применяется после него
+	vals, _ = url.ParseQuery(`regex=^Heap\d+$&limit=10`)
+	f, _ = parseListFilter(vals)
+	if query, _ = buildListQuery(f); strings.Contains(query, "~") || strings.Contains(query, "LIMIT") {
+		t.Errorf("unexpected pattern or limit in query %s", query)
+	}
+}
+
+func metricIDs(metrics []*service.Metrics) []string {
+	ids := make([]string, len(metrics))
+	for i, met := range metrics {
+		ids[i] = met.ID
+	}
+	return ids
+}
@@ -3,48 +3,53 @@ package server
 import (
 	ctx "context"
 	"errors"
-	"sync"
 	"runtime"
+	"sort"
+	"sync"
+	"time"
 
 	log "metrics/internal/logger"
 	s "metrics/internal/service"
 )
 
-const metricsNumber = 31
+const (
+	metricsNumber = 31
+	historyLimit  = 10000 // максимум хранимых сэмплов на одну метрику
+)
 
 var numAllMetrics = runtime.NumCPU() + metricsNumber
 
 var ErrNoValue = errors.New("no such value in storage")
 
 type MemStorage struct {
-	items map[string]*s.Metrics
-	mtx   *sync.RWMutex
-	len   int
+	items   map[string]*s.Metrics
+	history map[string][]*s.Metrics
+	mtx     *sync.RWMutex
+	buckets []float64 // корзины новых гистограмм из одиночных наблюдений
+	len     int
 }
 
 func NewMemStore() *MemStorage {
 	return &MemStorage{
-		items: make(map[string]*s.Metrics, metricsNumber),
-		mtx:   &sync.RWMutex{},
+		items:   make(map[string]*s.Metrics, metricsNumber),
+		history: make(map[string][]*s.Metrics, metricsNumber),
+		mtx:     &sync.RWMutex{},
 	}
 }
 
 func (ms *MemStorage) Put(_ ctx.Context, met *s.Metrics) (*s.Metrics, error) {
 	ms.mtx.Lock()
-	oldMet, exists := ms.items[met.ID]
-	met.MergeMetrics(oldMet)
-	ms.items[met.ID] = met
-	if !exists {
-		ms.len++
+	defer ms.mtx.Unlock()
+	if err := ms.put(met, time.Now()); err != nil {
+		return nil, err
 	}
-	ms.mtx.Unlock()
 	return met, nil
 }
 
 func (ms *MemStorage) Get(_ ctx.Context, m *s.Metrics) (*s.Metrics, error) {
 	var err error
 	ms.mtx.RLock()
-	met, ok := ms.items[m.ID]
+	met, ok := ms.items[m.Key()]
 	ms.mtx.RUnlock()
 	if !ok {
 		err = ErrNoValue
@@ -64,20 +69,161 @@ func (ms *MemStorage) List(_ ctx.Context) ([]*s.Metrics, error) {
 	return metrics, nil
 }
 
+// ListPage метрики, отобранные и упорядоченные по фильтру.
+func (ms *MemStorage) ListPage(cx ctx.Context, f *ListFilter) ([]*s.Metrics, error) {
+	metrics, _ := ms.List(cx)
+	return f.apply(metrics), nil
+}
+
 func (ms *MemStorage) PutBatch(cx ctx.Context, mets []*s.Metrics) error {
+	now := time.Now()
 	ms.mtx.Lock()
+	defer ms.mtx.Unlock()
+	return ms.putBatch(mets, now, nil)
+}
+
+// putBatch сливает пакет с текущими значениями и передает итоги в persist;
+// хранилище меняется, только если persist (nil — не нужен) завершился без ошибки.
+// Вызывается под блокировкой.
+func (ms *MemStorage) putBatch(mets []*s.Metrics, now time.Time, persist func([]*s.Metrics) error) error {
+	if err := ms.checkBounds(mets); err != nil {
+		return err
+	}
+	merged := make(map[string]*s.Metrics, len(mets))
 	for _, met := range mets {
-		oldMet, exists := ms.items[met.ID]
-		met.MergeMetrics(oldMet)
-		ms.items[met.ID] = met
+		key := met.Key()
+		oldMet, exists := merged[key]
 		if !exists {
-			ms.len++
+			oldMet, exists = ms.items[key]
+		}
+		if err := ms.merge(met, oldMet, exists, now); err != nil {
+			return err
+		}
+		merged[key] = met
+	}
+	if persist != nil {
+		if err := persist(mets); err != nil {
+			return err
+		}
+	}
+	for _, met := range mets {
+		ms.store(met.Key(), met)
+	}
+	return nil
+}
+
+// checkBounds отклоняет пакет целиком, если в нем есть гистограмма, которая
+// не сливается с сохраненной: пакет не должен записаться частично.
+// Вызывается под блокировкой.
+func (ms *MemStorage) checkBounds(mets []*s.Metrics) error {
+	bounds := make(map[string]*s.Histogram)
+	for _, met := range mets {
+		if !met.IsHistogram() || met.Hist == nil {
+			continue
+		}
+		key := met.Key()
+		prev, ok := bounds[key]
+		if old := ms.items[key]; !ok && old != nil {
+			prev = old.Hist
 		}
+		if prev != nil && !met.Hist.SameBounds(prev) {
+			return s.ErrHistBounds
+		}
+		bounds[key] = met.Hist
 	}
-	ms.mtx.Unlock()
 	return nil
 }
 
+func (ms *MemStorage) setBuckets(buckets []float64) {
+	ms.buckets = buckets
+}
+
+// Range возвращает сэмплы метрики в интервале [from, to] в порядке поступления.
+func (ms *MemStorage) Range(_ ctx.Context, m *s.Metrics, from, to time.Time) ([]*s.Metrics, error) {
+	ms.mtx.RLock()
+	defer ms.mtx.RUnlock()
+	samples, ok := ms.history[m.Key()]
+	if !ok {
+		return nil, ErrNoValue
+	}
+	fromMs, toMs := from.UnixMilli(), to.UnixMilli()
+	res := make([]*s.Metrics, 0, len(samples))
+	for _, smp := range samples {
+		if smp.Timestamp >= fromMs && smp.Timestamp <= toMs {
+			res = append(res, smp.Copy())
+		}
+	}
+	return res, nil
+}
+
 func (ms *MemStorage) Close() {
 	log.Info("Memory storage is closed;)")
 }
+
+// put сливает метрику с текущим значением и добавляет сэмпл в историю.
+// Вызывается под блокировкой.
+func (ms *MemStorage) put(met *s.Metrics, now time.Time) error {
+	key := met.Key()
+	oldMet, exists := ms.items[key]
+	if err := ms.merge(met, oldMet, exists, now); err != nil {
+		return err
+	}
+	ms.store(key, met)
+	return nil
+}
+
+// merge сливает метрику с прежним значением, не меняя хранилище.
+// Новая гистограмма из одиночного наблюдения получает корзины buckets
+// (по умолчанию s.DefaultBuckets).
+func (ms *MemStorage) merge(met, oldMet *s.Metrics, exists bool, now time.Time) error {
+	if !exists && ms.buckets != nil {
+		met.Observe(ms.buckets)
+	}
+	if err := met.MergeMetrics(oldMet); err != nil {
+		return err
+	}
+	met.Stamp(now)
+	return nil
+}
+
+func (ms *MemStorage) store(key string, met *s.Metrics) {
+	if _, exists := ms.items[key]; !exists {
+		ms.len++
+	}
+	ms.items[key] = met
+	ms.appendHistory(key, met)
+}
+
+// restore кладет сохраненный сэмпл без слияния счетчиков:
+// в истории хранятся уже накопленные значения. Вызывается под блокировкой.
+func (ms *MemStorage) restore(met *s.Metrics, now time.Time) {
+	met.Stamp(now)
+	key := met.Key()
+	if _, exists := ms.items[key]; !exists {
+		ms.len++
+	}
+	ms.items[key] = met
+	ms.appendHistory(key, met)
+}
+
+func (ms *MemStorage) appendHistory(key string, met *s.Metrics) {
+	samples := ms.history[key]
+	if len(samples) >= historyLimit {
+		samples = samples[1:]
+	}
+	ms.history[key] = append(samples, met.Copy())
+}
+
+// samples возвращает всю историю, упорядоченную по времени.
+func (ms *MemStorage) samples() []*s.Metrics {
+	ms.mtx.RLock()
+	res := make([]*s.Metrics, 0, len(ms.history))
+	for _, h := range ms.history {
+		res = append(res, h...)
+	}
+	ms.mtx.RUnlock()
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Timestamp < res[j].Timestamp
+	})
+	return res
+}
@@ -1,8 +1,14 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"log"
+	"strconv"
 	"testing"
+	"time"
+
+	"metrics/internal/service"
 )
 
 func TestWrite(t *testing.T) {
@@ -16,3 +22,85 @@ func TestWrite(t *testing.T) {
 		log.Println("\n\nTEST:", test.name)
 	}
 }
+
+func TestRange(t *testing.T) {
+	cx := context.Background()
+	ms := NewMemStore()
+	start := time.Now()
+	for i := 1; i <= 3; i++ {
+		met, err := service.NewMetric("counter", "PollCount", strconv.Itoa(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		met.Timestamp = start.Add(time.Duration(i) * time.Second).UnixMilli()
+		_, _ = ms.Put(cx, met)
+	}
+
+	samples, err := ms.Range(cx, &service.Metrics{ID: "PollCount", MType: "counter"},
+		start.Add(2*time.Second), start.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("expected 2 samples, got %d", len(samples))
+	}
+	if *samples[0].Delta != 3 || *samples[1].Delta != 6 {
+		t.Errorf("unexpected accumulated values: %d, %d", *samples[0].Delta, *samples[1].Delta)
+	}
+
+	if _, err = ms.Range(cx, &service.Metrics{ID: "unknown"}, start, start); err != ErrNoValue {
+		t.Errorf("expected ErrNoValue, got %v", err)
+	}
+}
+
+func TestPutHistogram(t *testing.T) {
+	cx := context.Background()
+	ms := NewMemStore()
+	for _, obs := range []string{"0.3", "0.07", "42"} {
+		met, err := service.NewMetric("histogram", "latency", obs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = ms.Put(cx, met)
+	}
+	met, err := ms.Get(cx, &service.Metrics{ID: "latency", MType: "histogram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if met.Hist.Count != 3 || met.Hist.Sum != 42.37 {
+		t.Errorf("unexpected count/sum: %d/%g", met.Hist.Count, met.Hist.Sum)
+	}
+	cum := met.Hist.Cumulative()
+	if cum[4] != 1 || cum[6] != 2 || cum[len(cum)-1] != 3 {
+		t.Errorf("unexpected buckets: %v", cum)
+	}
+
+	// гистограмма с другими границами отклоняется, накопленное сохраняется
+	other := &service.Metrics{ID: "latency", MType: "histogram", Hist: service.NewHistogram([]float64{1})}
+	other.Hist.Observe(0.5)
+	if _, err = ms.Put(cx, other); !errors.Is(err, service.ErrHistBounds) {
+		t.Errorf("expected ErrHistBounds, got %v", err)
+	}
+	batch := []*service.Metrics{service.BuildMetric("PollCount", int64(1)), other}
+	if err = ms.PutBatch(cx, batch); !errors.Is(err, service.ErrHistBounds) {
+		t.Errorf("expected ErrHistBounds for batch, got %v", err)
+	}
+	if _, err = ms.Get(cx, batch[0]); err != ErrNoValue {
+		t.Error("rejected batch must not be written partially")
+	}
+	met, _ = ms.Get(cx, other)
+	if met.Hist.Count != 3 || len(met.Hist.Counts) != len(service.DefaultBuckets)+1 {
+		t.Errorf("expected accumulated histogram, got %+v", met.Hist)
+	}
+
+	// новые гистограммы получают настроенные корзины
+	ms.setBuckets([]float64{10, 100})
+	obs, _ := service.NewMetric("histogram", "size", "50")
+	_, _ = ms.Put(cx, obs)
+	if met, _ = ms.Get(cx, obs); len(met.Hist.Bounds) != 2 || met.Hist.Counts[1] != 1 {
+		t.Errorf("expected configured buckets, got %+v", met.Hist)
+	}
+	if _, err = service.ParseBuckets("0.1,0.5,0.5,1"); err == nil {
+		t.Error("expected error for duplicate bounds")
+	}
+}
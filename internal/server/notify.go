@@ -0,0 +1,254 @@
+package server
+
+import (
+	"bytes"
+	ctx "context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	log "metrics/internal/logger"
+	sec "metrics/internal/security"
+	s "metrics/internal/service"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/pquerna/ffjson/ffjson"
+	"go.uber.org/zap"
+)
+
+const (
+	notifyTick    = time.Second
+	notifyTimeout = 10 * time.Second
+)
+
+// ErrWebhookRejected получатель отклонил уведомление (4xx): повтор бессмыслен.
+var ErrWebhookRejected = errors.New("notification rejected by webhook")
+
+// Notification тело POST-запроса на вебхук.
+type Notification struct {
+	GroupLabels map[string]string `json:"groupLabels,omitempty"`
+	Alerts      []*Alert          `json:"alerts"`
+	Group       string            `json:"group"`
+	Status      string            `json:"status"`
+	SentAt      time.Time         `json:"sentAt"`
+}
+
+// groupedAlert оповещение в группе; sent — о срабатывании уже сообщили.
+type groupedAlert struct {
+	alert     Alert
+	updatedAt time.Time
+	sent      bool
+}
+
+type alertGroup struct {
+	labels map[string]string
+	alerts map[string]*groupedAlert
+	sentAt time.Time
+}
+
+// notifier рассылает изменения оповещений на вебхуки. Оповещения
+// группируются по правилу и меткам groupBy; группа отправляется, когда
+// ее изменения старше groupWait, а горящая группа повторяется каждые repeat.
+// Заглушенные тишиной оповещения не отправляются.
+type notifier struct {
+	client    *http.Client
+	silences  *silences
+	key       string
+	urls      []string
+	groupBy   []string
+	groupWait time.Duration
+	repeat    time.Duration
+	mtx       sync.Mutex // защищает groups
+	groups    map[string]*alertGroup
+	wg        sync.WaitGroup // отправки в полете
+}
+
+func newNotifier(mm *MetricManager) *notifier {
+	return &notifier{
+		client:    &http.Client{Timeout: notifyTimeout},
+		silences:  mm.silences,
+		key:       mm.Key,
+		urls:      mm.Webhooks,
+		groupBy:   mm.NotifyGroupBy,
+		groupWait: mm.NotifyGroupWait,
+		repeat:    mm.NotifyRepeat,
+		groups:    make(map[string]*alertGroup),
+	}
+}
+
+func (n *notifier) run(cx ctx.Context, done chan struct{}) {
+	defer close(done)
+	tick := time.NewTicker(notifyTick)
+	defer tick.Stop()
+	for {
+		select {
+		case now := <-tick.C:
+			n.flush(cx, now)
+		case <-cx.Done():
+			n.wg.Wait()
+			log.Debug("goodbye from notifier...")
+			return
+		}
+	}
+}
+
+// update принимает переход оповещения в firing или resolved. Вызывается
+// под блокировкой движка, поэтому только обновляет группу.
+func (n *notifier) update(key string, a *Alert, now time.Time) {
+	if n == nil {
+		return
+	}
+	labels := make(map[string]string, len(n.groupBy))
+	for _, name := range n.groupBy {
+		if val, ok := a.Labels[name]; ok {
+			labels[name] = val
+		}
+	}
+	groupKey := a.Rule + (&s.Metrics{Labels: labels}).LabelString()
+
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	g, ok := n.groups[groupKey]
+	if !ok {
+		if a.State != AlertFiring {
+			return
+		}
+		g = &alertGroup{labels: labels, alerts: make(map[string]*groupedAlert)}
+		n.groups[groupKey] = g
+	}
+	ga, ok := g.alerts[key]
+	switch {
+	case a.State == AlertFiring:
+		ga = &groupedAlert{}
+		g.alerts[key] = ga
+	case !ok:
+		return
+	case !ga.sent:
+		// о срабатывании не сообщали — о решении тоже не нужно
+		delete(g.alerts, key)
+		return
+	}
+	ga.alert = *a
+	ga.updatedAt = now
+}
+
+// flush отправляет созревшие группы; пустые группы удаляются.
+func (n *notifier) flush(cx ctx.Context, now time.Time) {
+	var batch []*Notification
+	n.mtx.Lock()
+	for groupKey, g := range n.groups {
+		if msg := n.collect(groupKey, g, now); msg != nil {
+			batch = append(batch, msg)
+		}
+		if len(g.alerts) == 0 {
+			delete(n.groups, groupKey)
+		}
+	}
+	n.mtx.Unlock()
+	for _, msg := range batch {
+		n.send(cx, msg)
+	}
+}
+
+// collect собирает уведомление группы, если пора отправлять, и помечает
+// вошедшие в него оповещения отправленными.
+func (n *notifier) collect(groupKey string, g *alertGroup, now time.Time) *Notification {
+	var firing, fresh []string
+	due := false
+	for key, ga := range g.alerts {
+		if n.silences.silenced(&ga.alert, now) {
+			if ga.alert.State == AlertResolved {
+				delete(g.alerts, key)
+			}
+			continue
+		}
+		if ga.alert.State == AlertFiring {
+			firing = append(firing, key)
+		}
+		if ga.alert.State == AlertResolved || !ga.sent {
+			fresh = append(fresh, key)
+			due = due || now.Sub(ga.updatedAt) >= n.groupWait
+		}
+	}
+	repeat := len(firing) > 0 && n.repeat > 0 && !g.sentAt.IsZero() && now.Sub(g.sentAt) >= n.repeat
+	if !due && !repeat {
+		return nil
+	}
+	keys := append(firing, fresh...)
+	slices.Sort(keys)
+	keys = slices.Compact(keys)
+	msg := &Notification{
+		Group:       groupKey,
+		GroupLabels: g.labels,
+		Status:      AlertResolved,
+		SentAt:      now,
+		Alerts:      make([]*Alert, 0, len(keys)),
+	}
+	for _, key := range keys {
+		ga := g.alerts[key]
+		cp := ga.alert
+		msg.Alerts = append(msg.Alerts, &cp)
+		if ga.alert.State == AlertFiring {
+			msg.Status = AlertFiring
+			ga.sent = true
+		} else {
+			delete(g.alerts, key)
+		}
+	}
+	g.sentAt = now
+	return msg
+}
+
+// send отправляет уведомление на все вебхуки параллельно.
+func (n *notifier) send(cx ctx.Context, msg *Notification) {
+	data, err := ffjson.Marshal(msg)
+	if err != nil {
+		log.Warn("notify: marshal error", zap.Error(err))
+		return
+	}
+	for _, url := range n.urls {
+		n.wg.Add(1)
+		go func(url string) {
+			defer n.wg.Done()
+			err := s.Retry(cx, func() error {
+				err := n.post(cx, url, data)
+				if errors.Is(err, ErrWebhookRejected) {
+					return backoff.Permanent(err)
+				}
+				return err
+			})
+			if err != nil {
+				log.Warn("notify: webhook error", zap.String("url", url),
+					zap.String("group", msg.Group), zap.Error(err))
+			}
+		}(url)
+	}
+}
+
+func (n *notifier) post(cx ctx.Context, url string, data []byte) error {
+	req, err := http.NewRequestWithContext(cx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.key != "" {
+		req.Header.Set("HashSHA256", sec.Hash(&data, n.key))
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post notification: %w", err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return fmt.Errorf("post notification: status %d", resp.StatusCode)
+	case resp.StatusCode >= http.StatusBadRequest:
+		return fmt.Errorf("%w: status %d", ErrWebhookRejected, resp.StatusCode)
+	}
+	return nil
+}
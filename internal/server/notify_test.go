@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	sec "metrics/internal/security"
+
+	"github.com/pquerna/ffjson/ffjson"
+)
+
+func TestNotifier(t *testing.T) {
+	const key = "secret"
+	var (
+		mtx      sync.Mutex
+		received []*Notification
+	)
+	hook := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		if req.Header.Get("HashSHA256") != sec.Hash(&body, key) {
+			t.Error("bad notification sign")
+		}
+		var msg Notification
+		if err := ffjson.Unmarshal(body, &msg); err != nil {
+			t.Error(err)
+		}
+		mtx.Lock()
+		received = append(received, &msg)
+		mtx.Unlock()
+	}))
+	defer hook.Close()
+
+	n := newNotifier(&MetricManager{
+		Key:             key,
+		Webhooks:        []string{hook.URL},
+		NotifyGroupBy:   []string{"host"},
+		NotifyGroupWait: 30 * time.Second,
+		NotifyRepeat:    time.Hour,
+		silences:        newSilences(),
+	})
+	start := time.Now()
+	flush := func(at time.Duration) []*Notification {
+		n.flush(context.Background(), start.Add(at))
+		n.wg.Wait()
+		mtx.Lock()
+		defer mtx.Unlock()
+		got := received
+		received = nil
+		return got
+	}
+	fire := func(host string, state string, at time.Duration) {
+		a := &Alert{Rule: "HighHeap", Labels: map[string]string{"host": host, "pid": "1"}, State: state}
+		n.update("HighHeap"+host, a, start.Add(at))
+	}
+
+	fire("a", AlertFiring, 0)
+	fire("b", AlertFiring, 10*time.Second)
+	if got := flush(20 * time.Second); len(got) != 0 {
+		t.Fatalf("expected group wait, got %d notifications", len(got))
+	}
+	got := flush(40 * time.Second)
+	if len(got) != 2 {
+		t.Fatalf("expected a notification per host, got %d", len(got))
+	}
+	for _, msg := range got {
+		if msg.Status != AlertFiring || len(msg.Alerts) != 1 || msg.GroupLabels["host"] == "" {
+			t.Errorf("unexpected notification %+v", msg)
+		}
+	}
+
+	// решение заглушенного оповещения не отправляется
+	_, _ = n.silences.add(&Silence{
+		Matchers: map[string]string{silenceRuleKey: "HighHeap", "host": "b"},
+		EndsAt:   start.Add(2 * time.Hour),
+	}, start)
+	fire("a", AlertResolved, time.Minute)
+	fire("b", AlertResolved, time.Minute)
+	got = flush(2 * time.Minute)
+	if len(got) != 1 || got[0].Status != AlertResolved || got[0].GroupLabels["host"] != "a" {
+		t.Fatalf("expected only resolved host a, got %+v", got)
+	}
+
+	// срабатывание, снятое до отправки, не уведомляет вовсе
+	fire("c", AlertFiring, 3*time.Minute)
+	fire("c", AlertResolved, 3*time.Minute+5*time.Second)
+	if got = flush(5 * time.Minute); len(got) != 0 {
+		t.Fatalf("expected no notifications, got %d", len(got))
+	}
+
+	// повтор горящей группы
+	fire("d", AlertFiring, 6*time.Minute)
+	if got = flush(7 * time.Minute); len(got) != 1 {
+		t.Fatalf("expected firing notification, got %d", len(got))
+	}
+	if got = flush(30 * time.Minute); len(got) != 0 {
+		t.Fatalf("expected no repeat yet, got %d", len(got))
+	}
+	if got = flush(7*time.Minute + time.Hour); len(got) != 1 || got[0].Status != AlertFiring {
+		t.Fatalf("expected repeated notification, got %+v", got)
+	}
+}
+
+func TestSilences(t *testing.T) {
+	ss := newSilences()
+	now := time.Now()
+	if _, err := ss.add(&Silence{EndsAt: now.Add(time.Hour)}, now); err == nil {
+		t.Error("expected error for silence without matchers")
+	}
+	if _, err := ss.add(&Silence{Matchers: map[string]string{"host": "a"}, EndsAt: now.Add(-time.Hour)}, now); err == nil {
+		t.Error("expected error for expired silence")
+	}
+	sl, err := ss.add(&Silence{Matchers: map[string]string{"host": "a"}, EndsAt: now.Add(time.Hour)}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alert := &Alert{Rule: "r", Labels: map[string]string{"host": "a"}}
+	if !ss.silenced(alert, now) || ss.silenced(alert, now.Add(2*time.Hour)) {
+		t.Error("silence must match only while active")
+	}
+	if ss.silenced(&Alert{Rule: "r", Labels: map[string]string{"host": "b"}}, now) {
+		t.Error("silence must not match other labels")
+	}
+	if len(ss.list(now.Add(2*time.Hour))) != 0 {
+		t.Error("expired silence must be pruned")
+	}
+	if err = ss.remove(sl.ID); err != ErrNoSilence {
+		t.Errorf("expected ErrNoSilence for pruned silence, got %v", err)
+	}
+
+	// без правил оповещений тишины не принимаются
+	mm := &MetricManager{}
+	rec := httptest.NewRecorder()
+	mm.AddSilenceHandler(rec, httptest.NewRequest(http.MethodPost, "/silences",
+		strings.NewReader(`{"matchers":{"host":"a"},"endsAt":"2100-01-01T00:00:00Z"}`)))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 without alert rules, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	ctx "context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	log "metrics/internal/logger"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultPartitionAhead число дней, секции которых создаются заранее.
+	DefaultPartitionAhead = 3
+
+	partitionCheckInterval = time.Hour
+	partitionDateLayout    = "20060102"
+
+	listPartitions = "listPartitions"
+)
+
+// historyTables таблицы сэмплов, секционированные по дням (created_at, UTC).
+// Сэмплы вне созданных секций попадают в секцию <table>_default.
+var historyTables = []string{"gauge_history", "counter_history", "histogram_history"}
+
+var partitionQueries = map[string]string{
+	listPartitions: `SELECT c.relname FROM pg_inherits i
+			         JOIN pg_class c ON c.oid = i.inhrelid
+			         JOIN pg_class p ON p.oid = i.inhparent
+			         WHERE p.relname = $1`,
+}
+
+type querier interface {
+	Query(ctx.Context, string, ...any) (pgx.Rows, error)
+}
+
+func partitionName(table string, day time.Time) string {
+	return table + "_p" + day.Format(partitionDateLayout)
+}
+
+// partitionDay день секции по имени; false — не дневная секция таблицы.
+func partitionDay(table, name string) (time.Time, bool) {
+	suffix, ok := strings.CutPrefix(name, table+"_p")
+	if !ok {
+		return time.Time{}, false
+	}
+	day, err := time.Parse(partitionDateLayout, suffix)
+	return day, err == nil
+}
+
+// expiredPartitions секции, все сэмплы которых старше before.
+func expiredPartitions(table string, names []string, before time.Time) []string {
+	var expired []string
+	for _, name := range names {
+		if day, ok := partitionDay(table, name); ok && !day.AddDate(0, 0, 1).After(before) {
+			expired = append(expired, name)
+		}
+	}
+	return expired
+}
+
+// runPartitions создает секции на PartitionAhead дней вперед при старте
+// и затем раз в час до отмены контекста.
+func (db *DataBase) runPartitions(cx ctx.Context, done chan struct{}) {
+	defer close(done)
+	tick := time.NewTicker(partitionCheckInterval)
+	defer tick.Stop()
+	for {
+		if err := db.ensurePartitions(cx, time.Now()); err != nil && cx.Err() == nil {
+			log.Warn("partition manager error", zap.Error(err))
+		}
+		select {
+		case <-tick.C:
+		case <-cx.Done():
+			log.Debug("goodbye from partition manager...")
+			return
+		}
+	}
+}
+
+func (db *DataBase) ensurePartitions(cx ctx.Context, now time.Time) error {
+	conn, err := db.connectWithRetry(cx)
+	if err != nil {
+		return fmt.Errorf("partitions conn err: %w", err)
+	}
+	defer conn.Release()
+
+	today := now.UTC().Truncate(24 * time.Hour)
+	for _, table := range historyTables {
+		names, err := partitionsOf(cx, conn, table)
+		if err != nil {
+			return err
+		}
+		for i := 0; i <= db.PartitionAhead; i++ {
+			day := today.AddDate(0, 0, i)
+			name := partitionName(table, day)
+			if slices.Contains(names, name) {
+				continue
+			}
+			tx, err := conn.Begin(cx)
+			if err != nil {
+				return fmt.Errorf("failed transaction beginning: %w", err)
+			}
+			err = createPartition(cx, tx, table, day)
+			if err == nil {
+				err = tx.Commit(cx)
+			}
+			_ = tx.Rollback(cx)
+			if err != nil {
+				return fmt.Errorf("create partition %s: %w", name, err)
+			}
+			log.Debug("partition is created", zap.String("name", name))
+		}
+	}
+	return nil
+}
+
+// createPartition создает секцию дня и подключает ее к таблице. Сэмплы этого
+// дня, уже попавшие в секцию по умолчанию, переносятся в новую: иначе
+// подключение секции будет отклонено.
+func createPartition(cx ctx.Context, tx pgx.Tx, table string, day time.Time) error {
+	parent := pgx.Identifier{table}.Sanitize()
+	name := pgx.Identifier{partitionName(table, day)}.Sanitize()
+	def := pgx.Identifier{table + "_default"}.Sanitize()
+	from, to := day, day.AddDate(0, 0, 1)
+
+	if _, err := tx.Exec(cx, fmt.Sprintf(
+		`CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS)`, name, parent)); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(cx, fmt.Sprintf(
+		`WITH moved AS (DELETE FROM %s WHERE created_at >= $1 AND created_at < $2 RETURNING *)
+		 INSERT INTO %s SELECT * FROM moved`, def, name), from, to); err != nil {
+		return err
+	}
+	_, err := tx.Exec(cx, fmt.Sprintf(`ALTER TABLE %s ATTACH PARTITION %s FOR VALUES FROM ('%s') TO ('%s')`,
+		parent, name, from.Format(time.RFC3339), to.Format(time.RFC3339)))
+	return err
+}
+
+// dropPartitions удаляет секции истории, все сэмплы которых старше before.
+func dropPartitions(cx ctx.Context, tx pgx.Tx, before time.Time) error {
+	for _, table := range historyTables {
+		names, err := partitionsOf(cx, tx, table)
+		if err != nil {
+			return err
+		}
+		for _, name := range expiredPartitions(table, names, before) {
+			if _, err = tx.Exec(cx, "DROP TABLE "+pgx.Identifier{name}.Sanitize()); err != nil {
+				return fmt.Errorf("drop partition %s: %w", name, err)
+			}
+			log.Debug("partition is dropped", zap.String("name", name))
+		}
+	}
+	return nil
+}
+
+func partitionsOf(cx ctx.Context, conn querier, table string) ([]string, error) {
+	rows, err := conn.Query(cx, listPartitions, table)
+	if err != nil {
+		return nil, fmt.Errorf("list partitions of %s: %w", table, err)
+	}
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("list partitions of %s: %w", table, err)
+	}
+	return names, nil
+}
@@ -0,0 +1,30 @@
+package server
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestExpiredPartitions(t *testing.T) {
+	day := time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC)
+	if name := partitionName("gauge_history", day); name != "gauge_history_p20240610" {
+		t.Fatalf("unexpected partition name %s", name)
+	}
+	names := []string{
+		"gauge_history_default",
+		"gauge_history_p20240608",
+		"gauge_history_p20240609",
+		"gauge_history_p20240610",
+		"counter_history_p20240601",
+	}
+	// секция дня удаляется, только когда устарел весь день
+	got := expiredPartitions("gauge_history", names, day.Add(12*time.Hour))
+	expected := []string{"gauge_history_p20240608", "gauge_history_p20240609"}
+	if !slices.Equal(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	if got = expiredPartitions("gauge_history", names, day.Add(-time.Hour)); !slices.Equal(got, expected[:1]) {
+		t.Errorf("expected %v, got %v", expected[:1], got)
+	}
+}
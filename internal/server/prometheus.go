@@ -0,0 +1,142 @@
+package server
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "metrics/internal/logger"
+	s "metrics/internal/service"
+
+	"go.uber.org/zap"
+)
+
+const promContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// promName приводит ID метрики к допустимому в Prometheus имени
+// [a-zA-Z_:][a-zA-Z0-9_:]*, заменяя недопустимые символы на '_'.
+func promName(id string) string {
+	var b strings.Builder
+	b.Grow(len(id) + 1)
+	for i, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
+
+// promLabelName аналогична promName, но двоеточие в именах меток недопустимо.
+func promLabelName(name string) string {
+	return strings.ReplaceAll(promName(name), ":", "_")
+}
+
+var promValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+// promLabels формирует {k1="v1",k2="v2"} с отсортированными именами меток;
+// extra — дополнительные готовые пары, например le="0.5".
+func promLabels(labels map[string]string, extra ...string) string {
+	if len(labels) == 0 && len(extra) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels)+len(extra))
+	for name, val := range labels {
+		pairs = append(pairs, promLabelName(name)+`="`+promValueEscaper.Replace(val)+`"`)
+	}
+	pairs = append(pairs, extra...)
+	sort.Strings(pairs)
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+type promSeries struct {
+	name   string
+	labels string
+	mtype  string
+	lines  []string
+}
+
+func promFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// promHistogram раскладывает гистограмму на серии _bucket, _sum и _count.
+func promHistogram(name string, met *s.Metrics) []string {
+	h := met.Hist
+	cum := h.Cumulative()
+	lines := make([]string, 0, len(cum)+2)
+	for i, c := range cum {
+		le := "+Inf"
+		if i < len(h.Bounds) {
+			le = promFloat(h.Bounds[i])
+		}
+		lines = append(lines, name+"_bucket"+promLabels(met.Labels, `le="`+le+`"`)+
+			" "+strconv.FormatUint(c, 10))
+	}
+	labels := promLabels(met.Labels)
+	return append(lines,
+		name+"_sum"+labels+" "+promFloat(h.Sum),
+		name+"_count"+labels+" "+strconv.FormatUint(h.Count, 10))
+}
+
+// renderPrometheus формирует текстовый формат экспозиции 0.0.4.
+// Серии группируются по имени; если после очистки имен совпадают
+// тип семейства или набор меток, остается первая серия.
+func renderPrometheus(metrics []*s.Metrics) *bytes.Buffer {
+	series := make([]promSeries, 0, len(metrics))
+	for _, met := range metrics {
+		name, labels := promName(met.ID), promLabels(met.Labels)
+		var lines []string
+		switch {
+		case met.IsCounter() && met.Delta != nil:
+			lines = []string{name + labels + " " + strconv.FormatInt(*met.Delta, 10)}
+		case met.IsGauge() && met.Value != nil:
+			lines = []string{name + labels + " " + promFloat(*met.Value)}
+		case met.IsHistogram() && met.Hist != nil:
+			lines = promHistogram(name, met)
+		default:
+			continue
+		}
+		series = append(series, promSeries{
+			name:   name,
+			labels: labels,
+			mtype:  met.MType,
+			lines:  lines,
+		})
+	}
+	sort.SliceStable(series, func(i, j int) bool {
+		if series[i].name != series[j].name {
+			return series[i].name < series[j].name
+		}
+		return series[i].labels < series[j].labels
+	})
+
+	buf := new(bytes.Buffer)
+	var family, familyType, prevLabels string
+	for i, ser := range series {
+		if i == 0 || ser.name != family {
+			family, familyType = ser.name, ser.mtype
+			buf.WriteString("# TYPE " + ser.name + " " + ser.mtype + "\n")
+		} else if ser.mtype != familyType || ser.labels == prevLabels {
+			log.Warn("renderPrometheus(): duplicate metric series",
+				zap.String("name", ser.name), zap.String("labels", ser.labels))
+			continue
+		}
+		prevLabels = ser.labels
+		for _, line := range ser.lines {
+			buf.WriteString(line + "\n")
+		}
+	}
+	return buf
+}
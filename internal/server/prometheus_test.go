@@ -0,0 +1,59 @@
+package server
+
+import (
+	"testing"
+
+	"metrics/internal/service"
+)
+
+func TestPromName(t *testing.T) {
+	tests := map[string]string{
+		"HeapAlloc":     "HeapAlloc",
+		"cpu.user-time": "cpu_user_time",
+		"1stMetric":     "_1stMetric",
+		"ns:requests":   "ns:requests",
+		"загрузка":      "________",
+		"":              "_",
+	}
+	for id, expected := range tests {
+		if got := promName(id); got != expected {
+			t.Errorf("promName(%q) = %q, expected %q", id, got, expected)
+		}
+	}
+}
+
+func TestRenderPrometheus(t *testing.T) {
+	delta, value := int64(5), 1.5
+	mets := []*service.Metrics{
+		{ID: "b.gauge", MType: "gauge", Value: &value},
+		{ID: "a_count", MType: "counter", Delta: &delta},
+		{ID: "b-gauge", MType: "gauge", Value: &value},
+		{ID: "cpu", MType: "gauge", Value: &value, Labels: map[string]string{"core": "2"}},
+		{ID: "cpu", MType: "gauge", Value: &value, Labels: map[string]string{"core": "1", "host": `a"b`}},
+	}
+	expected := "# TYPE a_count counter\na_count 5\n" +
+		"# TYPE b_gauge gauge\nb_gauge 1.5\n" +
+		"# TYPE cpu gauge\ncpu{core=\"1\",host=\"a\\\"b\"} 1.5\ncpu{core=\"2\"} 1.5\n"
+	if got := renderPrometheus(mets).String(); got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestRenderPrometheusHistogram(t *testing.T) {
+	hist := service.NewHistogram([]float64{0.1, 1})
+	hist.Observe(0.05)
+	hist.Observe(0.5)
+	hist.Observe(2)
+	mets := []*service.Metrics{
+		{ID: "latency", MType: "histogram", Hist: hist, Labels: map[string]string{"path": "/"}},
+	}
+	expected := "# TYPE latency histogram\n" +
+		"latency_bucket{le=\"0.1\",path=\"/\"} 1\n" +
+		"latency_bucket{le=\"1\",path=\"/\"} 2\n" +
+		"latency_bucket{le=\"+Inf\",path=\"/\"} 3\n" +
+		"latency_sum{path=\"/\"} 2.55\n" +
+		"latency_count{path=\"/\"} 3\n"
+	if got := renderPrometheus(mets).String(); got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
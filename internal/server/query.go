@@ -0,0 +1,223 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"time"
+
+	s "metrics/internal/service"
+)
+
+const (
+	aggAvg  = "avg"
+	aggMin  = "min"
+	aggMax  = "max"
+	aggSum  = "sum"
+	aggLast = "last"
+	aggRate = "rate"
+
+	defaultQueryWindow = time.Hour
+	defaultQueryStep   = time.Minute
+	maxQueryPoints     = 11000
+)
+
+var (
+	ErrInvalidQuery = errors.New("invalid query parameters")
+	ErrRateOfGauge  = errors.New("rate is supported for counters and histograms only")
+)
+
+// Point значение метрики на шаге, Timestamp — начало шага в unix миллисекундах.
+type Point struct {
+	Timestamp int64   `json:"timestamp"`
+	Value     float64 `json:"value"`
+}
+
+type QueryResult struct {
+	Labels map[string]string `json:"labels,omitempty"`
+	ID     string            `json:"id"`
+	MType  string            `json:"type"`
+	Agg    string            `json:"agg"`
+	From   int64             `json:"from"`
+	To     int64             `json:"to"`
+	Step   int64             `json:"step"` // миллисекунды
+	Points []Point           `json:"points"`
+}
+
+type rangeQuery struct {
+	from time.Time
+	to   time.Time
+	step time.Duration
+	agg  string
+}
+
+// parseRangeQuery разбирает параметры from, to (RFC3339 или unix секунды),
+// step (длительность вида 30s или секунды) и agg.
+func parseRangeQuery(met *s.Metrics, vals url.Values) (*rangeQuery, error) {
+	q := &rangeQuery{
+		to:   time.Now(),
+		step: defaultQueryStep,
+		agg:  vals.Get("agg"),
+	}
+	var err error
+	if v := vals.Get("to"); v != "" {
+		if q.to, err = parseTime(v); err != nil {
+			return nil, err
+		}
+	}
+	q.from = q.to.Add(-defaultQueryWindow)
+	if v := vals.Get("from"); v != "" {
+		if q.from, err = parseTime(v); err != nil {
+			return nil, err
+		}
+	}
+	if v := vals.Get("step"); v != "" {
+		if q.step, err = parseStep(v); err != nil {
+			return nil, err
+		}
+	}
+	if q.agg == "" {
+		q.agg = aggLast
+	}
+
+	switch {
+	case !q.from.Before(q.to):
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidQuery)
+	case q.step <= 0:
+		return nil, fmt.Errorf("%w: step must be positive", ErrInvalidQuery)
+	case q.to.Sub(q.from)/q.step > maxQueryPoints:
+		return nil, fmt.Errorf("%w: too many points, increase step", ErrInvalidQuery)
+	}
+	switch q.agg {
+	case aggAvg, aggMin, aggMax, aggSum, aggLast:
+	case aggRate:
+		if met.IsGauge() {
+			return nil, ErrRateOfGauge
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown agg %q", ErrInvalidQuery, q.agg)
+	}
+	return q, nil
+}
+
+func parseTime(v string) (time.Time, error) {
+	if sec, err := strconv.ParseFloat(v, 64); err == nil {
+		return time.UnixMilli(int64(sec * 1000)), nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return t, fmt.Errorf("%w: bad time %q", ErrInvalidQuery, v)
+	}
+	return t, nil
+}
+
+func parseStep(v string) (time.Duration, error) {
+	if sec, err := strconv.ParseFloat(v, 64); err == nil {
+		return time.Duration(sec * float64(time.Second)), nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("%w: bad step %q", ErrInvalidQuery, v)
+	}
+	return d, nil
+}
+
+// sampleValue числовое значение сэмпла; для гистограммы — число наблюдений.
+func sampleValue(met *s.Metrics) float64 {
+	if met.Hist != nil {
+		return float64(met.Hist.Count)
+	}
+	if met.Delta != nil {
+		return float64(*met.Delta)
+	}
+	if met.Value != nil {
+		return *met.Value
+	}
+	return math.NaN()
+}
+
+// aggregate раскладывает упорядоченные по времени сэмплы по шагам,
+// выровненным относительно unix epoch, и сворачивает каждый шаг.
+// Пустые шаги пропускаются.
+func aggregate(samples []*s.Metrics, q *rangeQuery) []Point {
+	step := q.step.Milliseconds()
+	if step == 0 {
+		step = 1
+	}
+	points := make([]Point, 0)
+	var (
+		bucket  []float64
+		start   int64
+		prevEnd = math.NaN() // последнее значение предыдущего шага, для rate
+	)
+	flush := func() {
+		if len(bucket) == 0 {
+			return
+		}
+		points = append(points, Point{Timestamp: start, Value: fold(bucket, prevEnd, q)})
+		prevEnd = bucket[len(bucket)-1]
+		bucket = bucket[:0]
+	}
+	for _, smp := range samples {
+		v := sampleValue(smp)
+		if math.IsNaN(v) {
+			continue
+		}
+		bStart := smp.Timestamp - smp.Timestamp%step
+		if bStart != start {
+			flush()
+			start = bStart
+		}
+		bucket = append(bucket, v)
+	}
+	flush()
+	return points
+}
+
+func fold(vals []float64, prev float64, q *rangeQuery) float64 {
+	last := vals[len(vals)-1]
+	switch q.agg {
+	case aggMin:
+		res := vals[0]
+		for _, v := range vals[1:] {
+			res = math.Min(res, v)
+		}
+		return res
+	case aggMax:
+		res := vals[0]
+		for _, v := range vals[1:] {
+			res = math.Max(res, v)
+		}
+		return res
+	case aggSum, aggAvg:
+		var sum float64
+		for _, v := range vals {
+			sum += v
+		}
+		if q.agg == aggAvg {
+			return sum / float64(len(vals))
+		}
+		return sum
+	case aggRate:
+		// прирост накопленного счетчика за шаг в секунду;
+		// уменьшение значения считаем сбросом счетчика
+		base := prev
+		if math.IsNaN(base) {
+			base = vals[0]
+		}
+		var inc float64
+		for _, v := range vals {
+			if v < base {
+				inc += v
+			} else {
+				inc += v - base
+			}
+			base = v
+		}
+		return inc / q.step.Seconds()
+	default:
+		return last
+	}
+}
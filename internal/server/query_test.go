@@ -0,0 +1,67 @@
+package server
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"metrics/internal/service"
+)
+
+func TestAggregate(t *testing.T) {
+	counter := func(ts, val int64) *service.Metrics {
+		return &service.Metrics{ID: "c", MType: "counter", Delta: &val, Timestamp: ts}
+	}
+	samples := []*service.Metrics{
+		counter(0, 1), counter(500, 3), // шаг [0, 1000)
+		counter(1200, 4), counter(1900, 10), // шаг [1000, 2000)
+		counter(3100, 2), // сброс счетчика в шаге [3000, 4000)
+	}
+	tests := []struct {
+		agg      string
+		expected []Point
+	}{
+		{agg: aggLast, expected: []Point{{0, 3}, {1000, 10}, {3000, 2}}},
+		{agg: aggAvg, expected: []Point{{0, 2}, {1000, 7}, {3000, 2}}},
+		{agg: aggMin, expected: []Point{{0, 1}, {1000, 4}, {3000, 2}}},
+		{agg: aggMax, expected: []Point{{0, 3}, {1000, 10}, {3000, 2}}},
+		{agg: aggSum, expected: []Point{{0, 4}, {1000, 14}, {3000, 2}}},
+		{agg: aggRate, expected: []Point{{0, 2}, {1000, 7}, {3000, 2}}},
+	}
+	for _, test := range tests {
+		got := aggregate(samples, &rangeQuery{step: time.Second, agg: test.agg})
+		if len(got) != len(test.expected) {
+			t.Fatalf("%s: expected %v, got %v", test.agg, test.expected, got)
+		}
+		for i := range got {
+			if got[i] != test.expected[i] {
+				t.Errorf("%s: expected %v, got %v", test.agg, test.expected, got)
+				break
+			}
+		}
+	}
+}
+
+func TestParseRangeQuery(t *testing.T) {
+	gauge := &service.Metrics{ID: "g", MType: "gauge"}
+	tests := []struct {
+		name    string
+		query   string
+		wantErr bool
+	}{
+		{name: "defaults", query: ""},
+		{name: "unix and duration", query: "from=100&to=200&step=10s&agg=avg"},
+		{name: "rfc3339", query: "from=2024-01-01T00:00:00Z&to=2024-01-01T01:00:00Z&step=60"},
+		{name: "from after to", query: "from=200&to=100", wantErr: true},
+		{name: "rate of gauge", query: "agg=rate", wantErr: true},
+		{name: "unknown agg", query: "agg=median", wantErr: true},
+		{name: "too many points", query: "from=0&to=100000&step=1", wantErr: true},
+	}
+	for _, test := range tests {
+		vals, _ := url.ParseQuery(test.query)
+		_, err := parseRangeQuery(gauge, vals)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+	}
+}
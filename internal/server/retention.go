@@ -0,0 +1,336 @@
+package server
+
+import (
+	ctx "context"
+	"errors"
+	"fmt"
+	"time"
+
+	log "metrics/internal/logger"
+	s "metrics/internal/service"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+const (
+	resolutionRaw = "raw"
+	resolution1m  = "1m"
+	resolution1h  = "1h"
+
+	selectRolledUntil       = "selectRolledUntil"
+	updateRolledUntil       = "updateRolledUntil"
+	rollupGauge1m           = "rollupGauge1m"
+	rollupCounter1m         = "rollupCounter1m"
+	rollupHistogram1m       = "rollupHistogram1m"
+	rollup1h                = "rollup1h"
+	rollupHistogram1h       = "rollupHistogram1h"
+	deleteGaugeHistory      = "deleteGaugeHistory"
+	deleteCounterHistory    = "deleteCounterHistory"
+	deleteHistogramHistory  = "deleteHistogramHistory"
+	deleteRollup1m          = "deleteRollup1m"
+	deleteHistogramRollup1m = "deleteHistogramRollup1m"
+	deleteRollup1h          = "deleteRollup1h"
+	deleteHistogramRollup1h = "deleteHistogramRollup1h"
+	rangeRollup1m           = "rangeRollup1m"
+	rangeRollup1h           = "rangeRollup1h"
+	rangeHistogramRollup1m  = "rangeHistogramRollup1m"
+	rangeHistogramRollup1h  = "rangeHistogramRollup1h"
+)
+
+// Retention сроки хранения истории в БД. Сырые сэмплы сворачиваются в минутные
+// агрегаты, минутные — в часовые; данные старше срока удаляются после свертки.
+type Retention struct {
+	Raw      time.Duration
+	Minute   time.Duration
+	Hour     time.Duration // 0 — часовые агрегаты хранятся бессрочно
+	Interval time.Duration // период фоновой свертки и очистки
+}
+
+// Агрегаты шага: min, max, avg, last и число сэмплов; для счетчиков sum —
+// прирост за шаг (уменьшение значения считается сбросом). Гистограммы
+// накопленные, поэтому для них хранится последний снимок шага.
+// Свертка идемпотентна: повторный расчет шага перезаписывает агрегат.
+var retentionQueries = map[string]string{
+	selectRolledUntil: `SELECT rolled_until FROM rollup_state WHERE resolution = $1`,
+
+	updateRolledUntil: `INSERT INTO rollup_state(resolution, rolled_until) VALUES($1, $2)
+			            ON CONFLICT(resolution) DO UPDATE SET rolled_until = EXCLUDED.rolled_until`,
+
+	rollupGauge1m: `INSERT INTO rollup_1m(type, id, labels, bucket, min, max, avg, last, count, sum)
+			        SELECT 'gauge', id, labels, date_trunc('minute', created_at, 'UTC'),
+			               min(value), max(value), avg(value),
+			               (array_agg(value ORDER BY created_at DESC))[1], count(*), NULL
+			        FROM gauge_history
+			        WHERE created_at >= $1 AND created_at < $2
+			        GROUP BY id, labels, date_trunc('minute', created_at, 'UTC')
+			        ON CONFLICT(type, id, labels, bucket) DO UPDATE SET
+			            min = EXCLUDED.min, max = EXCLUDED.max, avg = EXCLUDED.avg,
+			            last = EXCLUDED.last, count = EXCLUDED.count, sum = EXCLUDED.sum`,
+
+	rollupCounter1m: `WITH smp AS (
+				          SELECT id, labels, value, created_at,
+				                 value - lag(value) OVER (PARTITION BY id, labels ORDER BY created_at) AS inc
+				          FROM counter_history
+				          WHERE created_at >= $1 - INTERVAL '1 hour' AND created_at < $2)
+			          INSERT INTO rollup_1m(type, id, labels, bucket, min, max, avg, last, count, sum)
+			          SELECT 'counter', id, labels, date_trunc('minute', created_at, 'UTC'),
+			                 min(value), max(value), avg(value),
+			                 (array_agg(value ORDER BY created_at DESC))[1], count(*),
+			                 sum(CASE WHEN inc < 0 THEN value ELSE COALESCE(inc, 0) END)
+			          FROM smp
+			          WHERE created_at >= $1
+			          GROUP BY id, labels, date_trunc('minute', created_at, 'UTC')
+			          ON CONFLICT(type, id, labels, bucket) DO UPDATE SET
+			              min = EXCLUDED.min, max = EXCLUDED.max, avg = EXCLUDED.avg,
+			              last = EXCLUDED.last, count = EXCLUDED.count, sum = EXCLUDED.sum`,
+
+	rollupHistogram1m: `INSERT INTO histogram_rollup_1m(id, labels, bucket, bounds, counts, sum, count)
+			            SELECT DISTINCT ON (id, labels, date_trunc('minute', created_at, 'UTC'))
+			                   id, labels, date_trunc('minute', created_at, 'UTC'), bounds, counts, sum, count
+			            FROM histogram_history
+			            WHERE created_at >= $1 AND created_at < $2
+			            ORDER BY id, labels, date_trunc('minute', created_at, 'UTC'), created_at DESC
+			            ON CONFLICT(id, labels, bucket) DO UPDATE SET
+			                bounds = EXCLUDED.bounds, counts = EXCLUDED.counts,
+			                sum = EXCLUDED.sum, count = EXCLUDED.count`,
+
+	rollup1h: `INSERT INTO rollup_1h(type, id, labels, bucket, min, max, avg, last, count, sum)
+			   SELECT type, id, labels, date_trunc('hour', bucket, 'UTC'),
+			          min(min), max(max), sum(avg * count) / sum(count),
+			          (array_agg(last ORDER BY bucket DESC))[1], sum(count), sum(sum)
+			   FROM rollup_1m
+			   WHERE bucket >= $1 AND bucket < $2
+			   GROUP BY type, id, labels, date_trunc('hour', bucket, 'UTC')
+			   ON CONFLICT(type, id, labels, bucket) DO UPDATE SET
+			       min = EXCLUDED.min, max = EXCLUDED.max, avg = EXCLUDED.avg,
+			       last = EXCLUDED.last, count = EXCLUDED.count, sum = EXCLUDED.sum`,
+
+	rollupHistogram1h: `INSERT INTO histogram_rollup_1h(id, labels, bucket, bounds, counts, sum, count)
+			            SELECT DISTINCT ON (id, labels, date_trunc('hour', bucket, 'UTC'))
+			                   id, labels, date_trunc('hour', bucket, 'UTC'), bounds, counts, sum, count
+			            FROM histogram_rollup_1m
+			            WHERE bucket >= $1 AND bucket < $2
+			            ORDER BY id, labels, date_trunc('hour', bucket, 'UTC'), bucket DESC
+			            ON CONFLICT(id, labels, bucket) DO UPDATE SET
+			                bounds = EXCLUDED.bounds, counts = EXCLUDED.counts,
+			                sum = EXCLUDED.sum, count = EXCLUDED.count`,
+
+	deleteGaugeHistory:      `DELETE FROM gauge_history WHERE created_at < $1`,
+	deleteCounterHistory:    `DELETE FROM counter_history WHERE created_at < $1`,
+	deleteHistogramHistory:  `DELETE FROM histogram_history WHERE created_at < $1`,
+	deleteRollup1m:          `DELETE FROM rollup_1m WHERE bucket < $1`,
+	deleteHistogramRollup1m: `DELETE FROM histogram_rollup_1m WHERE bucket < $1`,
+	deleteRollup1h:          `DELETE FROM rollup_1h WHERE bucket < $1`,
+	deleteHistogramRollup1h: `DELETE FROM histogram_rollup_1h WHERE bucket < $1`,
+
+	rangeRollup1m: `SELECT avg, last, bucket FROM rollup_1m
+			        WHERE type = $1 AND id = $2 AND labels = $3 AND bucket >= $4 AND bucket < $5
+			        ORDER BY bucket`,
+
+	rangeRollup1h: `SELECT avg, last, bucket FROM rollup_1h
+			        WHERE type = $1 AND id = $2 AND labels = $3 AND bucket >= $4 AND bucket < $5
+			        ORDER BY bucket`,
+
+	rangeHistogramRollup1m: `SELECT bounds, counts, sum, count, bucket FROM histogram_rollup_1m
+			                 WHERE id = $1 AND labels = $2 AND bucket >= $3 AND bucket < $4
+			                 ORDER BY bucket`,
+
+	rangeHistogramRollup1h: `SELECT bounds, counts, sum, count, bucket FROM histogram_rollup_1h
+			                 WHERE id = $1 AND labels = $2 AND bucket >= $3 AND bucket < $4
+			                 ORDER BY bucket`,
+}
+
+// runRetention периодически сворачивает и очищает историю до отмены контекста.
+func (db *DataBase) runRetention(cx ctx.Context, done chan struct{}) {
+	defer close(done)
+	tick := time.NewTicker(db.Retention.Interval)
+	defer tick.Stop()
+	for {
+		if err := db.compact(cx, time.Now()); err != nil && cx.Err() == nil {
+			log.Warn("retention error", zap.Error(err))
+		}
+		select {
+		case <-tick.C:
+		case <-cx.Done():
+			log.Debug("goodbye from retention...")
+			return
+		}
+	}
+}
+
+// compact сворачивает завершенные минуты и часы и удаляет данные старше
+// сроков хранения. Удаляется только уже свернутое.
+func (db *DataBase) compact(cx ctx.Context, now time.Time) error {
+	conn, err := db.connectWithRetry(cx)
+	if err != nil {
+		return fmt.Errorf("retention conn err: %w", err)
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(cx)
+	if err != nil {
+		return fmt.Errorf("failed transaction beginning: %w", err)
+	}
+	defer func() { _ = tx.Rollback(cx) }()
+
+	minuteEnd, hourEnd := now.Truncate(time.Minute), now.Truncate(time.Hour)
+	if err = rollup(cx, tx, resolution1m, minuteEnd,
+		rollupGauge1m, rollupCounter1m, rollupHistogram1m); err != nil {
+		return err
+	}
+	if err = rollup(cx, tx, resolution1h, hourEnd, rollup1h, rollupHistogram1h); err != nil {
+		return err
+	}
+
+	ret := db.Retention
+	rawCut, minuteCut := now.Add(-ret.Raw), now.Add(-ret.Minute)
+	// устаревшие дневные секции удаляются целиком, остаток — построчно
+	if err = dropPartitions(cx, tx, earliest(rawCut, minuteEnd)); err != nil {
+		return err
+	}
+	if err = purge(cx, tx, earliest(rawCut, minuteEnd),
+		deleteGaugeHistory, deleteCounterHistory, deleteHistogramHistory); err != nil {
+		return err
+	}
+	if err = purge(cx, tx, earliest(minuteCut, hourEnd),
+		deleteRollup1m, deleteHistogramRollup1m); err != nil {
+		return err
+	}
+	if ret.Hour > 0 {
+		if err = purge(cx, tx, now.Add(-ret.Hour), deleteRollup1h, deleteHistogramRollup1h); err != nil {
+			return err
+		}
+	}
+	if err = tx.Commit(cx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// rollup сворачивает шаги с последней свертки разрешения до until.
+func rollup(cx ctx.Context, tx pgx.Tx, resolution string, until time.Time, queries ...string) error {
+	var from time.Time
+	err := tx.QueryRow(cx, selectRolledUntil, resolution).Scan(&from)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("rollup %s state: %w", resolution, err)
+	}
+	if !from.Before(until) {
+		return nil
+	}
+	for _, query := range queries {
+		if _, err = tx.Exec(cx, query, from, until); err != nil {
+			return fmt.Errorf("rollup %s: %w", query, err)
+		}
+	}
+	if _, err = tx.Exec(cx, updateRolledUntil, resolution, until); err != nil {
+		return fmt.Errorf("rollup %s state: %w", resolution, err)
+	}
+	return nil
+}
+
+func purge(cx ctx.Context, tx pgx.Tx, before time.Time, queries ...string) error {
+	for _, query := range queries {
+		tag, err := tx.Exec(cx, query, before)
+		if err != nil {
+			return fmt.Errorf("purge %s: %w", query, err)
+		}
+		if tag.RowsAffected() > 0 {
+			log.Debug("purged", zap.String("query", query), zap.Int64("rows", tag.RowsAffected()))
+		}
+	}
+	return nil
+}
+
+func earliest(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// rangeSegment часть интервала чтения с одним разрешением: [from, to).
+type rangeSegment struct {
+	resolution string
+	from       time.Time
+	to         time.Time
+}
+
+// segments делит интервал по срокам хранения: самые свежие данные читаются
+// из сырой истории, более старые — из минутных, затем из часовых агрегатов.
+// Без Retention вся история сырая.
+func (ret *Retention) segments(from, to, now time.Time) []rangeSegment {
+	if ret == nil {
+		return []rangeSegment{{resolutionRaw, from, to}}
+	}
+	bounds := []struct {
+		resolution string
+		start      time.Time
+	}{
+		{resolution1h, from},
+		{resolution1m, now.Add(-ret.Minute)},
+		{resolutionRaw, now.Add(-ret.Raw)},
+	}
+	var segs []rangeSegment
+	for i, b := range bounds {
+		end := to
+		if i+1 < len(bounds) {
+			end = earliest(to, bounds[i+1].start)
+		}
+		start := from
+		if b.start.After(start) {
+			start = b.start
+		}
+		if start.Before(end) || (b.resolution == resolutionRaw && !start.After(end)) {
+			segs = append(segs, rangeSegment{b.resolution, start, end})
+		}
+	}
+	return segs
+}
+
+// rangeRollup сэмплы из агрегатов: для gauge — среднее за шаг,
+// для счетчика — последнее накопленное значение, для гистограммы — снимок.
+func rangeRollup(cx ctx.Context, conn *pgxpool.Conn, met *s.Metrics, seg rangeSegment) ([]*s.Metrics, error) {
+	if met.IsHistogram() {
+		query := rangeHistogramRollup1m
+		if seg.resolution == resolution1h {
+			query = rangeHistogramRollup1h
+		}
+		return scanHistogramSamples(cx, conn, met, query, seg.from, seg.to)
+	}
+	query := rangeRollup1m
+	if seg.resolution == resolution1h {
+		query = rangeRollup1h
+	}
+	rows, err := conn.Query(cx, query, met.MType, met.ID, labelSet(met), seg.from, seg.to)
+	if err != nil {
+		return nil, fmt.Errorf("db range rollup query err: %w", err)
+	}
+	defer rows.Close()
+	var samples []*s.Metrics
+	for rows.Next() {
+		var avg, last float64
+		var bucket time.Time
+		if err := rows.Scan(&avg, &last, &bucket); err != nil {
+			return nil, fmt.Errorf("db range rollup scan err: %w", err)
+		}
+		smp := &s.Metrics{
+			ID:        met.ID,
+			MType:     met.MType,
+			Labels:    met.Labels,
+			Timestamp: bucket.UnixMilli(),
+		}
+		if met.IsCounter() {
+			delta := int64(last)
+			smp.Delta = &delta
+		} else {
+			smp.Value = &avg
+		}
+		samples = append(samples, smp)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("db range rollup rows error: %w", err)
+	}
+	return samples, nil
+}
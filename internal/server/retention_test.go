@@ -0,0 +1,53 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetentionSegments(t *testing.T) {
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	ret := &Retention{Raw: 24 * time.Hour, Minute: 7 * 24 * time.Hour}
+	ago := func(d time.Duration) time.Time { return now.Add(-d) }
+
+	tests := []struct {
+		name     string
+		ret      *Retention
+		from, to time.Time
+		expected []rangeSegment
+	}{
+		{
+			name: "no retention", ret: nil, from: ago(30 * 24 * time.Hour), to: now,
+			expected: []rangeSegment{{resolutionRaw, ago(30 * 24 * time.Hour), now}},
+		},
+		{
+			name: "recent range is raw", ret: ret, from: ago(time.Hour), to: now,
+			expected: []rangeSegment{{resolutionRaw, ago(time.Hour), now}},
+		},
+		{
+			name: "range within minute rollups", ret: ret, from: ago(72 * time.Hour), to: ago(48 * time.Hour),
+			expected: []rangeSegment{{resolution1m, ago(72 * time.Hour), ago(48 * time.Hour)}},
+		},
+		{
+			name: "range across all resolutions", ret: ret, from: ago(30 * 24 * time.Hour), to: now,
+			expected: []rangeSegment{
+				{resolution1h, ago(30 * 24 * time.Hour), ago(7 * 24 * time.Hour)},
+				{resolution1m, ago(7 * 24 * time.Hour), ago(24 * time.Hour)},
+				{resolutionRaw, ago(24 * time.Hour), now},
+			},
+		},
+	}
+	for _, test := range tests {
+		got := test.ret.segments(test.from, test.to, now)
+		if len(got) != len(test.expected) {
+			t.Fatalf("%s: expected %v, got %v", test.name, test.expected, got)
+		}
+		for i := range got {
+			exp := test.expected[i]
+			if got[i].resolution != exp.resolution || !got[i].from.Equal(exp.from) || !got[i].to.Equal(exp.to) {
+				t.Errorf("%s: expected %v, got %v", test.name, test.expected, got)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	s "metrics/internal/service"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ruleThreshold = "threshold"
+	ruleAbsence   = "absence"
+	ruleRate      = "rate"
+
+	defaultRateWindow = time.Minute
+)
+
+var ErrInvalidRule = errors.New("invalid alert rule")
+
+// Rule правило оповещения для метрики Metric (и меток Labels, если заданы).
+// Срабатывает, когда условие выполняется не менее For:
+//   - threshold: значение метрики сравнивается с порогом;
+//   - absence: метрика не обновлялась дольше Absent;
+//   - rate: прирост счетчика в секунду за окно Window сравнивается с порогом.
+type Rule struct {
+	Labels    map[string]string
+	Name      string
+	Metric    string
+	MType     string // пусто — любой тип
+	Kind      string
+	Op        string
+	Summary   string
+	Threshold float64
+	Absent    time.Duration
+	Window    time.Duration
+	For       time.Duration
+}
+
+// ruleSpec правило в файле:
+//
+//	rules:
+//	  - name: HighHeap
+//	    metric: HeapAlloc
+//	    condition: "> 500MB"
+//	    for: 2m
+//	  - name: AgentDown
+//	    metric: PollCount
+//	    absent: 60s
+//	  - name: ErrorRate
+//	    metric: errors
+//	    rate: "> 5"
+//	    window: 1m
+type ruleSpec struct {
+	Labels    map[string]string `json:"labels" yaml:"labels"`
+	Name      string            `json:"name" yaml:"name"`
+	Metric    string            `json:"metric" yaml:"metric"`
+	Type      string            `json:"type" yaml:"type"`
+	Condition string            `json:"condition" yaml:"condition"`
+	Absent    string            `json:"absent" yaml:"absent"`
+	Rate      string            `json:"rate" yaml:"rate"`
+	Window    string            `json:"window" yaml:"window"`
+	For       string            `json:"for" yaml:"for"`
+	Summary   string            `json:"summary" yaml:"summary"`
+}
+
+type rulesFile struct {
+	Rules []ruleSpec `json:"rules" yaml:"rules"`
+}
+
+// LoadRules читает правила из файла YAML или JSON (по расширению .json).
+func LoadRules(path string) ([]*Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read rules: %w", err)
+	}
+	var file rulesFile
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, &file)
+	} else {
+		err = yaml.Unmarshal(data, &file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse rules: %w", err)
+	}
+	rules := make([]*Rule, 0, len(file.Rules))
+	names := make(map[string]bool, len(file.Rules))
+	for i := range file.Rules {
+		rule, err := file.Rules[i].compile()
+		if err != nil {
+			return nil, fmt.Errorf("rule #%d %q: %w", i+1, file.Rules[i].Name, err)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("%w: duplicate name %q", ErrInvalidRule, rule.Name)
+		}
+		names[rule.Name] = true
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (spec *ruleSpec) compile() (*Rule, error) {
+	rule := &Rule{
+		Name:    spec.Name,
+		Metric:  spec.Metric,
+		MType:   spec.Type,
+		Labels:  spec.Labels,
+		Summary: spec.Summary,
+	}
+	if rule.Name == "" || rule.Metric == "" {
+		return nil, fmt.Errorf("%w: name and metric are required", ErrInvalidRule)
+	}
+	if met := (&s.Metrics{MType: rule.MType}); rule.MType != "" &&
+		!met.IsGauge() && !met.IsCounter() && !met.IsHistogram() {
+		return nil, fmt.Errorf("%w: type %q", ErrInvalidRule, rule.MType)
+	}
+	var err error
+	if rule.For, err = parseRuleDuration(spec.For, 0); err != nil {
+		return nil, err
+	}
+	switch {
+	case spec.Condition != "" && spec.Absent == "" && spec.Rate == "":
+		rule.Kind = ruleThreshold
+		rule.Op, rule.Threshold, err = parseCondition(spec.Condition)
+	case spec.Absent != "" && spec.Condition == "" && spec.Rate == "":
+		rule.Kind = ruleAbsence
+		rule.Absent, err = parseRuleDuration(spec.Absent, 0)
+		if err == nil && rule.Absent <= 0 {
+			err = fmt.Errorf("%w: absent must be positive", ErrInvalidRule)
+		}
+	case spec.Rate != "" && spec.Condition == "" && spec.Absent == "":
+		rule.Kind = ruleRate
+		if rule.MType == "" {
+			rule.MType = "counter"
+		}
+		if rule.MType == "gauge" {
+			return nil, ErrRateOfGauge
+		}
+		if rule.Op, rule.Threshold, err = parseCondition(spec.Rate); err != nil {
+			return nil, err
+		}
+		rule.Window, err = parseRuleDuration(spec.Window, defaultRateWindow)
+	default:
+		return nil, fmt.Errorf("%w: exactly one of condition, absent, rate is required", ErrInvalidRule)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+func parseRuleDuration(v string, def time.Duration) (time.Duration, error) {
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%w: bad duration %q", ErrInvalidRule, v)
+	}
+	return d, nil
+}
+
+// parseCondition разбирает условие вида "> 500MB". Суффиксы KB, MB, GB, TB
+// двоичные (1024), как у счетчиков памяти runtime.
+func parseCondition(cond string) (string, float64, error) {
+	cond = strings.TrimSpace(cond)
+	var op string
+	for _, candidate := range []string{">=", "<=", "==", "!=", ">", "<"} {
+		if strings.HasPrefix(cond, candidate) {
+			op = candidate
+			break
+		}
+	}
+	if op == "" {
+		return "", 0, fmt.Errorf("%w: condition %q has no operator", ErrInvalidRule, cond)
+	}
+	num := strings.TrimSpace(strings.TrimPrefix(cond, op))
+	mult := 1.0
+	for i, suffix := range []string{"KB", "MB", "GB", "TB"} {
+		if strings.HasSuffix(strings.ToUpper(num), suffix) {
+			num = strings.TrimSpace(num[:len(num)-len(suffix)])
+			mult = float64(uint64(1) << (10 * (i + 1)))
+			break
+		}
+	}
+	val, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("%w: bad threshold in %q", ErrInvalidRule, cond)
+	}
+	return op, val * mult, nil
+}
+
+func compareThreshold(v float64, op string, threshold float64) bool {
+	switch op {
+	case ">":
+		return v > threshold
+	case ">=":
+		return v >= threshold
+	case "<":
+		return v < threshold
+	case "<=":
+		return v <= threshold
+	case "==":
+		return v == threshold
+	default:
+		return v != threshold
+	}
+}
@@ -0,0 +1,226 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	ctx "context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	log "metrics/internal/logger"
+	sec "metrics/internal/security"
+	s "metrics/internal/service"
+
+	"github.com/pquerna/ffjson/ffjson"
+	"go.uber.org/zap"
+)
+
+const (
+	instanceLabel    = "instance"
+	scrapeUp         = "scrape_up"
+	scrapeDuration   = "scrape_duration_seconds"
+	scrapeSamples    = "scrape_samples"
+	maxScrapeTimeout = 10 * time.Second
+)
+
+var ErrScrape = errors.New("scrape failed")
+
+// scraper опрашивает агентов в режиме pull. Цели — статический список
+// и файл (по цели в строке), который перечитывается при изменении.
+// Агенты отдают счетчики нарастающим итогом, в хранилище пишется прирост.
+type scraper struct {
+	storage     Storage
+	client      *http.Client
+	key         string
+	static      []string
+	file        string
+	fileTargets []string
+	fileMod     time.Time
+	interval    time.Duration
+	mtx         sync.Mutex       // защищает totals
+	totals      map[string]int64 // последний итог счетчика по ключу с меткой instance
+}
+
+func newScraper(mm *MetricManager) *scraper {
+	timeout := min(mm.ScrapeInterval, maxScrapeTimeout)
+	return &scraper{
+		storage:  mm.Storage,
+		client:   &http.Client{Timeout: timeout},
+		key:      mm.Key,
+		static:   mm.ScrapeTargets,
+		file:     mm.ScrapeFile,
+		interval: mm.ScrapeInterval,
+		totals:   make(map[string]int64),
+	}
+}
+
+func (sc *scraper) run(cx ctx.Context, done chan<- struct{}) {
+	defer close(done)
+	tick := time.NewTicker(sc.interval)
+	defer tick.Stop()
+	for {
+		sc.scrapeAll(cx)
+		select {
+		case <-tick.C:
+		case <-cx.Done():
+			log.Debug("goodbye from scraper...")
+			return
+		}
+	}
+}
+
+func (sc *scraper) scrapeAll(cx ctx.Context) {
+	wg := sync.WaitGroup{}
+	for _, target := range sc.targets() {
+		wg.Add(1)
+		go func(target string) {
+			defer wg.Done()
+			sc.scrape(cx, target)
+		}(target)
+	}
+	wg.Wait()
+}
+
+// targets статические цели и цели из файла без повторов.
+func (sc *scraper) targets() []string {
+	if sc.file != "" {
+		sc.reloadFile()
+	}
+	targets := append(slices.Clone(sc.static), sc.fileTargets...)
+	slices.Sort(targets)
+	return slices.Compact(targets)
+}
+
+// reloadFile перечитывает файл целей, если он изменился.
+// При ошибке чтения остается прежний список.
+func (sc *scraper) reloadFile() {
+	info, err := os.Stat(sc.file)
+	if err != nil {
+		log.Warn("scrape targets file", zap.Error(err))
+		return
+	}
+	if info.ModTime().Equal(sc.fileMod) {
+		return
+	}
+	data, err := os.ReadFile(sc.file)
+	if err != nil {
+		log.Warn("scrape targets file", zap.Error(err))
+		return
+	}
+	sc.fileTargets = parseTargets(data)
+	sc.fileMod = info.ModTime()
+	log.Info("scrape targets reloaded", zap.Strings("targets", sc.fileTargets))
+}
+
+func parseTargets(data []byte) []string {
+	var targets []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		targets = append(targets, line)
+	}
+	return targets
+}
+
+// scrape собирает метрики цели и записывает их вместе с состоянием сбора.
+func (sc *scraper) scrape(cx ctx.Context, target string) {
+	start := time.Now()
+	metrics, err := sc.fetch(cx, target)
+	up := 1.0
+	if err != nil {
+		log.Warn("scrape error", zap.String("target", target), zap.Error(err))
+		up, metrics = 0, nil
+	}
+	instance := map[string]string{instanceLabel: target}
+	health := []*s.Metrics{
+		s.BuildMetric(scrapeUp, up),
+		s.BuildMetric(scrapeDuration, time.Since(start).Seconds()),
+		s.BuildMetric(scrapeSamples, float64(len(metrics))),
+	}
+	for _, met := range health {
+		met.Labels = instance
+	}
+	if err = sc.storage.PutBatch(cx, append(metrics, health...)); err != nil {
+		log.Warn("scrape store error", zap.String("target", target), zap.Error(err))
+	}
+}
+
+func (sc *scraper) fetch(cx ctx.Context, target string) ([]*s.Metrics, error) {
+	url := target
+	if !strings.Contains(target, "://") {
+		url = "http://" + target + s.SnapshotPath
+	}
+	req, err := http.NewRequestWithContext(cx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+	resp, err := sc.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrScrape, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: status %d", ErrScrape, resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: read body: %w", ErrScrape, err)
+	}
+	// с ключом неподписанный снимок отклоняется: иначе подменить метрики
+	// сможет любой, кто ответит по адресу цели
+	if sc.key != "" && sec.Hash(&body, sc.key) != resp.Header.Get("HashSHA256") {
+		return nil, fmt.Errorf("%w: missing or wrong sign", ErrScrape)
+	}
+	var metrics []*s.Metrics
+	if err = ffjson.Unmarshal(body, &metrics); err != nil {
+		return nil, fmt.Errorf("%w: unmarshal: %w", ErrScrape, err)
+	}
+	metrics = slices.DeleteFunc(metrics, func(met *s.Metrics) bool {
+		return met == nil || met.Validate() != nil
+	})
+	discardClientTime(metrics...)
+	for _, met := range metrics {
+		labels := maps.Clone(met.Labels)
+		if labels == nil {
+			labels = make(map[string]string, 1)
+		}
+		labels[instanceLabel] = target
+		met.Labels = labels
+	}
+	sc.toDeltas(metrics)
+	return metrics, nil
+}
+
+// toDeltas переводит итоги счетчиков в приращения с прошлого сбора.
+// Первый сбор метрики только запоминает итог: после перезапуска сервера
+// итог уже учтен в сохраненном значении. Итог меньше прошлого означает
+// перезапуск агента, и приращением становится весь итог.
+func (sc *scraper) toDeltas(metrics []*s.Metrics) {
+	sc.mtx.Lock()
+	defer sc.mtx.Unlock()
+	for _, met := range metrics {
+		if !met.IsCounter() || met.Delta == nil {
+			continue
+		}
+		key, total := met.Key(), *met.Delta
+		last, ok := sc.totals[key]
+		switch {
+		case !ok:
+			*met.Delta = 0
+		case total >= last:
+			*met.Delta = total - last
+		}
+		sc.totals[key] = total
+	}
+}
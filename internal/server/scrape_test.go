@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	sec "metrics/internal/security"
+	s "metrics/internal/service"
+)
+
+func TestScrape(t *testing.T) {
+	totals := []int{4, 10, 3, 7, 9} // третий сбор — после перезапуска агента
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != s.SnapshotPath {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		total := totals[0]
+		totals = totals[1:]
+		_, _ = fmt.Fprintf(w, `[{"id":"PollCount","type":"counter","delta":%d},null,
+			{"id":"CPUutilization","type":"gauge","value":12.5,"labels":{"cpu":"1"}}]`, total)
+	}))
+	defer srv.Close()
+	target := strings.TrimPrefix(srv.URL, "http://")
+	dead := "127.0.0.1:1"
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "targets")
+	_ = os.WriteFile(file, []byte("# agents\n"+dead+"\n"), 0o600)
+
+	cx := context.Background()
+	mm := &MetricManager{
+		Storage:        NewMemStore(),
+		ScrapeTargets:  []string{target},
+		ScrapeFile:     file,
+		ScrapeInterval: time.Second,
+	}
+	sc := newScraper(mm)
+	sc.scrapeAll(cx)
+
+	counter, _ := mm.Get(cx, &s.Metrics{ID: "PollCount", MType: "counter", Labels: map[string]string{instanceLabel: target}})
+	if counter == nil || counter.Delta == nil || *counter.Delta != 0 {
+		t.Errorf("expected baseline PollCount 0 with instance label, got %v", counter)
+	}
+	gauge, _ := mm.Get(cx, &s.Metrics{ID: "CPUutilization", MType: "gauge",
+		Labels: map[string]string{"cpu": "1", instanceLabel: target}})
+	if gauge == nil || gauge.Value == nil || *gauge.Value != 12.5 {
+		t.Errorf("expected labeled gauge, got %v", gauge)
+	}
+	for instance, want := range map[string]float64{target: 1, dead: 0} {
+		up, _ := mm.Get(cx, &s.Metrics{ID: scrapeUp, MType: "gauge", Labels: map[string]string{instanceLabel: instance}})
+		if up == nil || up.Value == nil || *up.Value != want {
+			t.Errorf("expected up=%v for %s, got %v", want, instance, up)
+		}
+	}
+
+	// итоги агента переводятся в приращения
+	sc.scrape(cx, target)
+	sc.scrape(cx, target)
+	counter, _ = mm.Get(cx, &s.Metrics{ID: "PollCount", MType: "counter", Labels: map[string]string{instanceLabel: target}})
+	if counter == nil || counter.Delta == nil || *counter.Delta != 9 {
+		t.Errorf("expected PollCount 9 after agent restart, got %v", counter)
+	}
+
+	// перезапуск сервера: хранилище то же, итог агента не учитывается повторно
+	restarted := newScraper(mm)
+	restarted.scrape(cx, target)
+	restarted.scrape(cx, target)
+	counter, _ = mm.Get(cx, &s.Metrics{ID: "PollCount", MType: "counter", Labels: map[string]string{instanceLabel: target}})
+	if counter == nil || counter.Delta == nil || *counter.Delta != 11 {
+		t.Errorf("expected PollCount 11 after server restart, got %v", counter)
+	}
+
+	// цель удалена из файла — больше не опрашивается
+	_ = os.WriteFile(file, []byte("\n"), 0o600)
+	_ = os.Chtimes(file, time.Now(), time.Now().Add(time.Minute))
+	if got := sc.targets(); len(got) != 1 || got[0] != target {
+		t.Errorf("expected only static target after reload, got %v", got)
+	}
+}
+
+func TestScrapeSign(t *testing.T) {
+	const key = "secret"
+	body := []byte(`[{"id":"Alloc","type":"gauge","value":1}]`)
+	for sign, ok := range map[string]bool{"": false, "bad": false, sec.Hash(&body, key): true} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			if sign != "" {
+				w.Header().Set("HashSHA256", sign)
+			}
+			_, _ = w.Write(body)
+		}))
+		sc := newScraper(&MetricManager{Storage: NewMemStore(), Key: key, ScrapeInterval: time.Second})
+		_, err := sc.fetch(context.Background(), strings.TrimPrefix(srv.URL, "http://"))
+		srv.Close()
+		if (err == nil) != ok {
+			t.Errorf("sign %q: unexpected result %v", sign, err)
+		}
+	}
+}
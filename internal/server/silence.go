@@ -0,0 +1,116 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// silenceRuleKey ключ условия, сравниваемый с именем правила, а не с меткой.
+const silenceRuleKey = "rule"
+
+var (
+	ErrInvalidSilence = errors.New("invalid silence")
+	ErrNoSilence      = errors.New("no such silence")
+)
+
+// Silence подавляет уведомления об оповещениях, у которых совпадают все
+// условия Matchers, в интервале [StartsAt, EndsAt).
+type Silence struct {
+	Matchers  map[string]string `json:"matchers"`
+	ID        string            `json:"id"`
+	Comment   string            `json:"comment,omitempty"`
+	CreatedBy string            `json:"createdBy,omitempty"`
+	StartsAt  time.Time         `json:"startsAt"`
+	EndsAt    time.Time         `json:"endsAt"`
+}
+
+func (sl *Silence) active(now time.Time) bool {
+	return !now.Before(sl.StartsAt) && now.Before(sl.EndsAt)
+}
+
+func (sl *Silence) matches(a *Alert) bool {
+	for name, val := range sl.Matchers {
+		if name == silenceRuleKey {
+			if a.Rule != val {
+				return false
+			}
+		} else if a.Labels[name] != val {
+			return false
+		}
+	}
+	return true
+}
+
+// silences хранятся в памяти: после перезапуска сервера их нужно завести заново.
+type silences struct {
+	mtx   sync.RWMutex
+	items map[string]*Silence
+}
+
+func newSilences() *silences {
+	return &silences{items: make(map[string]*Silence)}
+}
+
+// add проверяет и сохраняет тишину; начало по умолчанию — сейчас.
+func (ss *silences) add(sl *Silence, now time.Time) (*Silence, error) {
+	if len(sl.Matchers) == 0 {
+		return nil, fmt.Errorf("%w: matchers are required", ErrInvalidSilence)
+	}
+	if sl.StartsAt.IsZero() {
+		sl.StartsAt = now
+	}
+	if !sl.EndsAt.After(sl.StartsAt) || !sl.EndsAt.After(now) {
+		return nil, fmt.Errorf("%w: endsAt must be after startsAt and now", ErrInvalidSilence)
+	}
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	sl.ID = hex.EncodeToString(id)
+
+	ss.mtx.Lock()
+	ss.items[sl.ID] = sl
+	ss.mtx.Unlock()
+	return sl, nil
+}
+
+func (ss *silences) remove(id string) error {
+	ss.mtx.Lock()
+	defer ss.mtx.Unlock()
+	if _, ok := ss.items[id]; !ok {
+		return ErrNoSilence
+	}
+	delete(ss.items, id)
+	return nil
+}
+
+// list действующие и будущие тишины по времени окончания; истекшие удаляются.
+func (ss *silences) list(now time.Time) []*Silence {
+	ss.mtx.Lock()
+	res := make([]*Silence, 0, len(ss.items))
+	for id, sl := range ss.items {
+		if !now.Before(sl.EndsAt) {
+			delete(ss.items, id)
+			continue
+		}
+		cp := *sl
+		res = append(res, &cp)
+	}
+	ss.mtx.Unlock()
+	slices.SortFunc(res, func(a, b *Silence) int { return a.EndsAt.Compare(b.EndsAt) })
+	return res
+}
+
+func (ss *silences) silenced(a *Alert, now time.Time) bool {
+	ss.mtx.RLock()
+	defer ss.mtx.RUnlock()
+	for _, sl := range ss.items {
+		if sl.active(now) && sl.matches(a) {
+			return true
+		}
+	}
+	return false
+}
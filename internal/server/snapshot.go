@@ -0,0 +1,99 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// snapshotHeader первая строка снимка: sha256 тела в hex.
+const snapshotHeader = "metrics-snapshot sha256="
+
+var ErrSnapshotChecksum = errors.New("snapshot checksum mismatch")
+
+func encodeSnapshot(body []byte) []byte {
+	sum := sha256.Sum256(body)
+	buf := bytes.NewBuffer(make([]byte, 0, len(snapshotHeader)+sha256.Size*2+1+len(body)))
+	buf.WriteString(snapshotHeader)
+	buf.WriteString(hex.EncodeToString(sum[:]))
+	buf.WriteByte('\n')
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+// decodeSnapshot проверяет контрольную сумму и возвращает тело снимка.
+// Снимки старого формата без заголовка возвращаются как есть.
+func decodeSnapshot(b []byte) ([]byte, error) {
+	if !bytes.HasPrefix(b, []byte(snapshotHeader)) {
+		return b, nil
+	}
+	header, body, ok := bytes.Cut(b, []byte{'\n'})
+	if !ok {
+		return nil, ErrSnapshotChecksum
+	}
+	sum := sha256.Sum256(body)
+	if string(header[len(snapshotHeader):]) != hex.EncodeToString(sum[:]) {
+		return nil, ErrSnapshotChecksum
+	}
+	return body, nil
+}
+
+// snapshotPaths текущий снимок и keep предыдущих, от новых к старым.
+func snapshotPaths(path string, keep int) []string {
+	paths := make([]string, 0, keep+1)
+	paths = append(paths, path)
+	for i := 1; i <= keep; i++ {
+		paths = append(paths, path+"."+strconv.Itoa(i))
+	}
+	return paths
+}
+
+// writeSnapshot атомарно заменяет снимок: запись во временный файл, fsync,
+// сдвиг предыдущих снимков, rename и fsync каталога.
+func writeSnapshot(path string, body []byte, keep int) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("create temp snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // после rename файла уже нет
+	if _, err = tmp.Write(encodeSnapshot(body)); err == nil {
+		err = tmp.Sync()
+	}
+	if cErr := tmp.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return fmt.Errorf("write temp snapshot: %w", err)
+	}
+	if err = os.Chmod(tmp.Name(), permissions); err != nil {
+		return fmt.Errorf("chmod temp snapshot: %w", err)
+	}
+
+	paths := snapshotPaths(path, keep)
+	for i := len(paths) - 1; i > 0; i-- {
+		if err = os.Rename(paths[i-1], paths[i]); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("rotate snapshot: %w", err)
+		}
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("rename snapshot: %w", err)
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("open snapshot dir: %w", err)
+	}
+	defer d.Close()
+	if err = d.Sync(); err != nil {
+		return fmt.Errorf("sync snapshot dir: %w", err)
+	}
+	return nil
+}
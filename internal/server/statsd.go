@@ -0,0 +1,234 @@
+package server
+
+import (
+	ctx "context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "metrics/internal/logger"
+	s "metrics/internal/service"
+
+	"go.uber.org/zap"
+)
+
+const (
+	statsdFlushInterval = time.Second
+	statsdMaxBatch      = 1000
+	statsdPacketSize    = 65535
+	statsdReadBackoff   = time.Second // пауза после ошибки чтения сокета
+)
+
+var ErrStatsdLine = errors.New("invalid statsd line")
+
+type statsdLine struct {
+	met      *s.Metrics
+	relative bool // gauge со знаком: изменение относительно текущего значения
+}
+
+// parseStatsd разбирает строку вида name:value|type[|@rate][|#k:v,...].
+// Счетчики (c) делятся на частоту выборки, таймеры (ms, h) становятся
+// наблюдениями гистограммы (ms — в секундах), gauge со знаком +/- —
+// относительным изменением.
+func parseStatsd(line string) (*statsdLine, error) {
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return nil, ErrStatsdLine
+	}
+	fields := strings.Split(rest, "|")
+	if len(fields) < 2 {
+		return nil, ErrStatsdLine
+	}
+	val, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad value %q", ErrStatsdLine, fields[0])
+	}
+	rate := 1.0
+	var labels map[string]string
+	for _, f := range fields[2:] {
+		switch {
+		case strings.HasPrefix(f, "@"):
+			rate, err = strconv.ParseFloat(f[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return nil, fmt.Errorf("%w: bad sample rate %q", ErrStatsdLine, f)
+			}
+		case strings.HasPrefix(f, "#"):
+			labels = parseStatsdTags(f[1:])
+		}
+	}
+
+	res := &statsdLine{met: &s.Metrics{ID: name, Labels: labels}}
+	switch fields[1] {
+	case "c":
+		delta := int64(math.Round(val / rate))
+		res.met.MType = "counter"
+		res.met.Delta = &delta
+	case "g":
+		res.met.MType = "gauge"
+		res.met.Value = &val
+		res.relative = fields[0][0] == '+' || fields[0][0] == '-'
+	case "ms":
+		// корзины гистограмм в секундах, как у Prometheus
+		val /= 1000
+		res.met.MType = "histogram"
+		res.met.Value = &val
+	case "h":
+		res.met.MType = "histogram"
+		res.met.Value = &val
+	default:
+		return nil, fmt.Errorf("%w: unsupported type %q", ErrStatsdLine, fields[1])
+	}
+	return res, nil
+}
+
+// parseStatsdTags разбирает теги DogStatsD вида k1:v1,k2:v2.
+func parseStatsdTags(str string) map[string]string {
+	labels := make(map[string]string)
+	for _, tag := range strings.Split(str, ",") {
+		k, v, _ := strings.Cut(tag, ":")
+		if k != "" {
+			labels[k] = v
+		}
+	}
+	return labels
+}
+
+// statsdListener принимает метрики по UDP и сбрасывает их
+// в хранилище пачками раз в statsdFlushInterval.
+type statsdListener struct {
+	storage  Storage
+	conn     net.PacketConn
+	mtx      sync.Mutex
+	counters map[string]*s.Metrics
+	gauges   map[string]*s.Metrics
+	timers   []*s.Metrics
+}
+
+func newStatsdListener(addr string, storage Storage) (*statsdListener, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("statsd listen: %w", err)
+	}
+	return &statsdListener{
+		storage:  storage,
+		conn:     conn,
+		counters: make(map[string]*s.Metrics),
+		gauges:   make(map[string]*s.Metrics),
+	}, nil
+}
+
+// serve читает пакеты до отмены контекста, затем сбрасывает остаток и закрывает done.
+func (sl *statsdListener) serve(cx ctx.Context, done chan struct{}) {
+	go sl.flushWait(cx, done)
+	go func() {
+		<-cx.Done()
+		_ = sl.conn.Close()
+	}()
+	buf := make([]byte, statsdPacketSize)
+	for {
+		n, _, err := sl.conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				// устойчивая ошибка сокета не должна крутить цикл вхолостую
+				log.Warn("statsd read error", zap.Error(err))
+				select {
+				case <-time.After(statsdReadBackoff):
+				case <-cx.Done():
+				}
+				continue
+			}
+			log.Debug("statsd listener is done...")
+			return
+		}
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			if line = strings.TrimSpace(line); line == "" {
+				continue
+			}
+			parsed, err := parseStatsd(line)
+			if err != nil {
+				log.Debug("statsd: skip line", zap.String("line", line), zap.Error(err))
+				continue
+			}
+			sl.add(cx, parsed)
+		}
+	}
+}
+
+func (sl *statsdListener) add(cx ctx.Context, line *statsdLine) {
+	met := line.met
+	key := met.Key()
+	if line.relative {
+		sl.mtx.Lock()
+		base, ok := sl.gauges[key]
+		sl.mtx.Unlock()
+		if !ok {
+			base, _ = sl.storage.Get(cx, met.Copy())
+		}
+		if base != nil && base.Value != nil {
+			*met.Value += *base.Value
+		}
+	}
+
+	sl.mtx.Lock()
+	switch {
+	case met.IsCounter():
+		if old, ok := sl.counters[key]; ok {
+			*old.Delta += *met.Delta
+		} else {
+			sl.counters[key] = met
+		}
+	case met.IsGauge():
+		sl.gauges[key] = met
+	default:
+		sl.timers = append(sl.timers, met)
+	}
+	full := len(sl.counters)+len(sl.gauges)+len(sl.timers) >= statsdMaxBatch
+	sl.mtx.Unlock()
+	if full {
+		sl.flush(cx)
+	}
+}
+
+func (sl *statsdListener) flush(cx ctx.Context) {
+	sl.mtx.Lock()
+	batch := make([]*s.Metrics, 0, len(sl.counters)+len(sl.gauges)+len(sl.timers))
+	for _, met := range sl.counters {
+		batch = append(batch, met)
+	}
+	for _, met := range sl.gauges {
+		batch = append(batch, met)
+	}
+	batch = append(batch, sl.timers...)
+	sl.counters = make(map[string]*s.Metrics)
+	sl.gauges = make(map[string]*s.Metrics)
+	sl.timers = nil
+	sl.mtx.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+	if err := sl.storage.PutBatch(cx, batch); err != nil {
+		log.Warn("statsd: couldn't write the batch", zap.Error(err))
+	}
+}
+
+func (sl *statsdListener) flushWait(cx ctx.Context, done chan struct{}) {
+	ticker := time.NewTicker(statsdFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			sl.flush(cx)
+		case <-cx.Done():
+			sl.flush(ctx.WithoutCancel(cx))
+			log.Debug("statsd flushWait is done...")
+			close(done)
+			return
+		}
+	}
+}
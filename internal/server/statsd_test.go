@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"metrics/internal/service"
+)
+
+func TestParseStatsd(t *testing.T) {
+	tests := []struct {
+		line     string
+		mtype    string
+		value    float64
+		relative bool
+		labels   string
+		wantErr  bool
+	}{
+		{line: "hits:3|c", mtype: "counter", value: 3},
+		{line: "hits:1|c|@0.1", mtype: "counter", value: 10},
+		{line: "temp:21.5|g", mtype: "gauge", value: 21.5},
+		{line: "temp:-2|g", mtype: "gauge", value: -2, relative: true},
+		{line: "req:320|ms|#path:/,code:200", mtype: "histogram", value: 0.32, labels: `{code="200",path="/"}`},
+		{line: "size:320|h", mtype: "histogram", value: 320},
+		{line: "users:42|s", wantErr: true},
+		{line: "broken|c", wantErr: true},
+		{line: "hits:x|c", wantErr: true},
+		{line: "hits:1|c|@2", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := parseStatsd(test.line)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%q: unexpected error: %v", test.line, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		var val float64
+		if got.met.Delta != nil {
+			val = float64(*got.met.Delta)
+		} else {
+			val = *got.met.Value
+		}
+		if got.met.MType != test.mtype || val != test.value ||
+			got.relative != test.relative || got.met.LabelString() != test.labels {
+			t.Errorf("%q: unexpected result %+v", test.line, got.met)
+		}
+	}
+}
+
+func TestStatsdFlush(t *testing.T) {
+	cx := context.Background()
+	ms := NewMemStore()
+	sl := &statsdListener{
+		storage:  ms,
+		counters: make(map[string]*service.Metrics),
+		gauges:   make(map[string]*service.Metrics),
+	}
+	for _, line := range []string{"hits:2|c", "hits:3|c", "temp:10|g", "temp:+5|g", "req:200|ms"} {
+		parsed, err := parseStatsd(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sl.add(cx, parsed)
+	}
+	sl.flush(cx)
+
+	hits, _ := ms.Get(cx, &service.Metrics{ID: "hits", MType: "counter"})
+	temp, _ := ms.Get(cx, &service.Metrics{ID: "temp", MType: "gauge"})
+	req, _ := ms.Get(cx, &service.Metrics{ID: "req", MType: "histogram"})
+	if hits == nil || *hits.Delta != 5 {
+		t.Errorf("expected hits 5, got %v", hits)
+	}
+	if temp == nil || *temp.Value != 15 {
+		t.Errorf("expected temp 15, got %v", temp)
+	}
+	// 200ms попадают в корзину le=0.25 секунды, а не в +Inf
+	if req == nil || req.Hist.Count != 1 || req.Hist.Counts[5] != 1 {
+		t.Errorf("expected one observation in 0.25s bucket, got %v", req)
+	}
+}
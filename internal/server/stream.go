@@ -0,0 +1,216 @@
+package server
+
+import (
+	ctx "context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "metrics/internal/logger"
+	s "metrics/internal/service"
+
+	"go.uber.org/zap"
+)
+
+const (
+	streamBuffer    = 256 // событий в очереди подписчика
+	streamKeepAlive = 15 * time.Second
+)
+
+// subscriber подписчик /stream. Переполненная очередь не блокирует запись
+// в хранилище: лишние события отбрасываются и считаются в dropped.
+type subscriber struct {
+	filter  *ListFilter
+	events  chan *s.Metrics
+	dropped atomic.Int64
+}
+
+// streamHub раздает принятые хранилищем метрики подписчикам.
+type streamHub struct {
+	mtx    sync.RWMutex // защищает subs и closed
+	subs   map[*subscriber]struct{}
+	closed bool
+}
+
+func newStreamHub() *streamHub {
+	return &streamHub{subs: make(map[*subscriber]struct{})}
+}
+
+func (h *streamHub) subscribe(f *ListFilter) *subscriber {
+	sub := &subscriber{filter: f, events: make(chan *s.Metrics, streamBuffer)}
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if h.closed {
+		close(sub.events)
+		return sub
+	}
+	h.subs[sub] = struct{}{}
+	return sub
+}
+
+func (h *streamHub) unsubscribe(sub *subscriber) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.events)
+	}
+}
+
+// close завершает все подписки: обработчики /stream возвращаются
+// и не задерживают остановку http-сервера.
+func (h *streamHub) close() {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.closed = true
+	for sub := range h.subs {
+		delete(h.subs, sub)
+		close(sub.events)
+	}
+}
+
+func (h *streamHub) len() int {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+	return len(h.subs)
+}
+
+func (h *streamHub) publish(mets ...*s.Metrics) {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+	if len(h.subs) == 0 {
+		return
+	}
+	for _, met := range mets {
+		var cp *s.Metrics // одна копия на всех подписчиков, они ее только читают
+		for sub := range h.subs {
+			if !sub.filter.Match(met) {
+				continue
+			}
+			if cp == nil {
+				cp = met.Copy()
+			}
+			select {
+			case sub.events <- cp:
+			default:
+				sub.dropped.Add(1)
+			}
+		}
+	}
+}
+
+// streamStorage публикует каждую принятую запись, по какому бы пути
+// (HTTP, gRPC, statsd, scrape) она ни пришла.
+type streamStorage struct {
+	Storage
+	hub *streamHub
+}
+
+func (ss *streamStorage) Put(cx ctx.Context, met *s.Metrics) (*s.Metrics, error) {
+	m, err := ss.Storage.Put(cx, met)
+	if err == nil {
+		ss.hub.publish(m)
+	}
+	return m, err
+}
+
+// PutBatch публикует метрики пакета: после записи хранилища содержат
+// в них сохраненные значения, для счетчиков — накопленный итог.
+func (ss *streamStorage) PutBatch(cx ctx.Context, mets []*s.Metrics) error {
+	err := ss.Storage.PutBatch(cx, mets)
+	if err == nil {
+		ss.hub.publish(mets...)
+	}
+	return err
+}
+
+// baseStorage хранилище под оберткой трансляции.
+func baseStorage(st Storage) Storage {
+	if ss, ok := st.(*streamStorage); ok {
+		return ss.Storage
+	}
+	return st
+}
+
+// EnableStream включает трансляцию /stream. Вызывается до запуска
+// http-сервера; Run включает ее сам.
+func (mm *MetricManager) EnableStream() {
+	if mm.stream != nil {
+		return
+	}
+	mm.stream = newStreamHub()
+	mm.Storage = &streamStorage{Storage: mm.Storage, hub: mm.stream}
+	mm.RegisterOnShutdown(mm.stream.close)
+}
+
+// StreamSubscribers число открытых подписок /stream.
+func (mm *MetricManager) StreamSubscribers() int {
+	if mm.stream == nil {
+		return 0
+	}
+	return mm.stream.len()
+}
+
+// StreamHandler отдает принятые метрики как Server-Sent Events. Фильтры
+// type, prefix, glob и regex — как у списка метрик. Отброшенные из-за
+// медленного клиента события сообщаются событием dropped с их числом.
+// Контекст запроса должен отменяться при отключении клиента, поэтому
+// маршрут не оборачивается серверным контекстом.
+func (mm *MetricManager) StreamHandler(rw http.ResponseWriter, req *http.Request) {
+	if mm.stream == nil {
+		http.Error(rw, "stream is not available", http.StatusServiceUnavailable)
+		return
+	}
+	filter, err := parseListFilter(req.URL.Query())
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	flusher := http.NewResponseController(rw)
+	sub := mm.stream.subscribe(filter)
+	defer mm.stream.unsubscribe(sub)
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.Header().Set("X-Accel-Buffering", "no")
+	rw.WriteHeader(http.StatusOK)
+	if err = flusher.Flush(); err != nil {
+		log.Warn("StreamHandler(): flush is not supported", zap.Error(err))
+		return
+	}
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case met, ok := <-sub.events:
+			if !ok {
+				return
+			}
+			if n := sub.dropped.Swap(0); n > 0 {
+				if _, err = fmt.Fprintf(rw, "event: dropped\ndata: %d\n\n", n); err != nil {
+					return
+				}
+			}
+			data, err := met.MarshalJSON()
+			if err != nil {
+				log.Warn("StreamHandler(): marshal error", zap.Error(err))
+				continue
+			}
+			if _, err = fmt.Fprintf(rw, "event: metric\ndata: %s\n\n", data); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err = rw.Write([]byte(": keep-alive\n\n")); err != nil {
+				return
+			}
+		case <-req.Context().Done():
+			return
+		}
+		// ошибка записи или сброса означает, что клиент отключился
+		if err = flusher.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"metrics/internal/service"
+)
+
+func TestStreamHub(t *testing.T) {
+	hub := newStreamHub()
+	filter, err := parseListFilter(url.Values{"type": {"gauge"}, "glob": {"Heap*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := hub.subscribe(filter)
+	st := &streamStorage{Storage: NewMemStore(), hub: hub}
+
+	done := make(chan struct{})
+	go func() { // медленный подписчик не должен блокировать запись
+		defer close(done)
+		for i := 0; i < streamBuffer+10; i++ {
+			_, _ = st.Put(context.Background(), service.BuildMetric("HeapAlloc", float64(i)))
+		}
+		_ = st.PutBatch(context.Background(), []*service.Metrics{
+			service.BuildMetric("HeapInuse", float64(1)),
+			service.BuildMetric("PollCount", int64(1)),
+			service.BuildMetric("Alloc", float64(1)),
+		})
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Put blocked on a full subscriber")
+	}
+	if got := len(sub.events); got != streamBuffer {
+		t.Errorf("expected full buffer of %d, got %d", streamBuffer, got)
+	}
+	if got := sub.dropped.Load(); got != 11 {
+		t.Errorf("expected 11 dropped events, got %d", got)
+	}
+	if met := <-sub.events; met.ID != "HeapAlloc" || *met.Value != 0 {
+		t.Errorf("unexpected first event %v", met)
+	}
+
+	hub.close()
+	for range sub.events { // после close канал закрыт
+	}
+	if _, ok := <-hub.subscribe(filter).events; ok {
+		t.Error("expected closed subscription after hub close")
+	}
+}
+
+func TestStreamBatchTotals(t *testing.T) {
+	hub := newStreamHub()
+	filter, _ := parseListFilter(url.Values{"type": {"counter"}})
+	sub := hub.subscribe(filter)
+	st := &streamStorage{Storage: NewMemStore(), hub: hub}
+	for i := 0; i < 2; i++ {
+		if err := st.PutBatch(context.Background(), []*service.Metrics{service.BuildMetric("PollCount", int64(3))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-sub.events
+	if met := <-sub.events; *met.Delta != 6 {
+		t.Errorf("expected stored total 6 in second event, got %d", *met.Delta)
+	}
+
+	// итоги из БД раскладываются по сэмплам пакета, как в истории
+	batch := []*service.Metrics{
+		service.BuildMetric("PollCount", int64(2)),
+		service.BuildMetric("Alloc", float64(1)),
+		service.BuildMetric("PollCount", int64(5)),
+	}
+	setCounterTotals(batch, map[string]int64{batch[0].Key(): 17})
+	if *batch[0].Delta != 12 || *batch[2].Delta != 17 {
+		t.Errorf("expected totals 12 and 17, got %d and %d", *batch[0].Delta, *batch[2].Delta)
+	}
+}
+
+func TestStreamHandler(t *testing.T) {
+	mm := &MetricManager{stream: newStreamHub()}
+	mm.Storage = &streamStorage{Storage: NewMemStore(), hub: mm.stream}
+	srv := httptest.NewServer(http.HandlerFunc(mm.StreamHandler))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "?type=counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	// подписка создается до заголовков ответа, поэтому запись уже видна
+	_, _ = mm.Put(context.Background(), service.BuildMetric("HeapAlloc", float64(1)))
+	_, _ = mm.Put(context.Background(), service.BuildMetric("PollCount", int64(5)))
+
+	lines := bufio.NewScanner(resp.Body)
+	var event []string
+	for lines.Scan() && lines.Text() != "" {
+		event = append(event, lines.Text())
+	}
+	if len(event) != 2 || event[0] != "event: metric" ||
+		!strings.Contains(event[1], `"id":"PollCount"`) || !strings.Contains(event[1], `"delta":5`) {
+		t.Errorf("unexpected event %q", event)
+	}
+
+	bad, err := http.Get(srv.URL + "?regex=(")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad.Body.Close()
+	if bad.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for bad pattern, got %d", bad.StatusCode)
+	}
+}
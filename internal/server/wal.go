@@ -0,0 +1,172 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	log "metrics/internal/logger"
+	s "metrics/internal/service"
+
+	"github.com/pquerna/ffjson/ffjson"
+	"go.uber.org/zap"
+)
+
+// WALSync политика fsync журнала упреждающей записи.
+type WALSync uint8
+
+const (
+	WALSyncAlways   WALSync = iota // fsync после каждой записи
+	WALSyncEverySec                // fsync раз в секунду в фоне
+	WALSyncNo                      // сброс на диск остается за ОС
+)
+
+const (
+	walSuffix       = ".wal"
+	walSnapshotSize = 4 << 20 // размер журнала, после которого снимается снимок при interval <= 0
+)
+
+var ErrWALSync = errors.New("invalid wal sync policy")
+
+func ParseWALSync(str string) (WALSync, error) {
+	switch str {
+	case "", "always":
+		return WALSyncAlways, nil
+	case "everysec":
+		return WALSyncEverySec, nil
+	case "no":
+		return WALSyncNo, nil
+	}
+	return 0, fmt.Errorf("%w: %q", ErrWALSync, str)
+}
+
+// wal журнал сэмплов, принятых после последнего снимка.
+// Каждая запись — JSON-массив сэмплов одного Put/PutBatch на отдельной строке.
+type wal struct {
+	file   *os.File
+	mtx    sync.Mutex
+	policy WALSync
+	size   int64
+	dirty  bool
+}
+
+func openWAL(path string, policy WALSync) (*wal, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, permissions)
+	if err != nil {
+		return nil, fmt.Errorf("open wal: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("stat wal: %w", err)
+	}
+	w := &wal{file: file, policy: policy, size: info.Size()}
+	if w.size > 0 {
+		// оборванная при сбое последняя запись не должна склеиться со следующей
+		last := make([]byte, 1)
+		if _, err = file.ReadAt(last, w.size-1); err == nil && last[0] != '\n' {
+			_, err = file.Write([]byte{'\n'})
+			w.size++
+		}
+		if err != nil {
+			_ = file.Close()
+			return nil, fmt.Errorf("repair wal tail: %w", err)
+		}
+	}
+	return w, nil
+}
+
+func (w *wal) append(samples []*s.Metrics) error {
+	b, err := ffjson.Marshal(samples)
+	if err != nil {
+		return fmt.Errorf("wal marshal: %w", err)
+	}
+	b = append(b, '\n')
+
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	n, err := w.file.Write(b)
+	w.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("wal write: %w", err)
+	}
+	if w.policy == WALSyncAlways {
+		if err = w.file.Sync(); err != nil {
+			return fmt.Errorf("wal sync: %w", err)
+		}
+		return nil
+	}
+	w.dirty = true
+	return nil
+}
+
+func (w *wal) sync() error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if !w.dirty {
+		return nil
+	}
+	w.dirty = false
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("wal sync: %w", err)
+	}
+	return nil
+}
+
+func (w *wal) truncate() error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if err := w.file.Truncate(0); err != nil {
+		return fmt.Errorf("wal truncate: %w", err)
+	}
+	w.size, w.dirty = 0, false
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("wal sync: %w", err)
+	}
+	return nil
+}
+
+func (w *wal) len() int64 {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	return w.size
+}
+
+func (w *wal) close() error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("wal sync: %w", err)
+	}
+	return w.file.Close()
+}
+
+// replay читает все записи журнала по порядку. Поврежденные записи
+// (например, оборванные при сбое) пропускаются.
+func (w *wal) replay() ([]*s.Metrics, error) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	var samples []*s.Metrics
+	reader := bufio.NewReader(io.NewSectionReader(w.file, 0, w.size))
+	for n := 1; ; n++ {
+		line, err := reader.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var rec []*s.Metrics
+			if uErr := ffjson.Unmarshal(line, &rec); uErr != nil {
+				log.Warn("wal replay: skip broken record", zap.Int("record", n), zap.Error(uErr))
+			} else {
+				samples = append(samples, rec...)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return samples, nil
+		}
+		if err != nil {
+			return samples, fmt.Errorf("wal read: %w", err)
+		}
+	}
+}
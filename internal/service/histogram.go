@@ -0,0 +1,138 @@
+package service
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Histogram распределение наблюдений по корзинам с верхними границами Bounds.
+// Counts содержит len(Bounds)+1 некумулятивных счетчиков, последний — для +Inf.
+//
+//go:generate ffjson $GOFILE
+type Histogram struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []uint64  `json:"counts"`
+	Sum    float64   `json:"sum"`
+	Count  uint64    `json:"count"`
+}
+
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{
+		Bounds: bounds,
+		Counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+func (h *Histogram) Observe(v float64) {
+	idx := sort.SearchFloat64s(h.Bounds, v)
+	h.Counts[idx]++
+	h.Count++
+	h.Sum += v
+}
+
+// Cumulative возвращает накопленные счетчики корзин в формате Prometheus (le).
+func (h *Histogram) Cumulative() []uint64 {
+	res := make([]uint64, len(h.Counts))
+	var acc uint64
+	for i, c := range h.Counts {
+		acc += c
+		res[i] = acc
+	}
+	return res
+}
+
+func (h *Histogram) add(h2 *Histogram) {
+	for i, c := range h2.Counts {
+		h.Counts[i] += c
+	}
+	h.Count += h2.Count
+	h.Sum += h2.Sum
+}
+
+// SameBounds у гистограмм одинаковые границы корзин: только такие складываются.
+func (h *Histogram) SameBounds(h2 *Histogram) bool {
+	if len(h.Bounds) != len(h2.Bounds) {
+		return false
+	}
+	for i, b := range h.Bounds {
+		if h2.Bounds[i] != b {
+			return false
+		}
+	}
+	return true
+}
+
+func (h *Histogram) valid() bool {
+	if len(h.Counts) != len(h.Bounds)+1 {
+		return false
+	}
+	var total uint64
+	for _, c := range h.Counts {
+		total += c
+	}
+	return total == h.Count && increasing(h.Bounds)
+}
+
+// increasing границы строго возрастают: повторная граница дала бы пустую корзину.
+func increasing(bounds []float64) bool {
+	for i := 1; i < len(bounds); i++ {
+		if bounds[i] <= bounds[i-1] {
+			return false
+		}
+	}
+	return true
+}
+
+// Observe превращает одиночное наблюдение (Value) в гистограмму с границами
+// bounds. Метрики с заданной гистограммой не меняются.
+func (met *Metrics) Observe(bounds []float64) {
+	if !met.IsHistogram() || met.Hist != nil {
+		return
+	}
+	met.Hist = NewHistogram(bounds)
+	if met.Value != nil {
+		met.Hist.Observe(*met.Value)
+	}
+	met.Value = nil
+}
+
+// mergeHistogram добавляет к гистограмме накопленное значение old.
+// Одиночное наблюдение (Value) раскладывается по корзинам old или DefaultBuckets.
+// Гистограмма с другими границами корзин отклоняется с ErrHistBounds,
+// чтобы не потерять накопленное.
+func (met *Metrics) mergeHistogram(old *Metrics) error {
+	var prev *Histogram
+	if old != nil && old.Hist != nil {
+		prev = old.Hist
+	}
+	if met.Hist == nil && prev != nil {
+		met.Observe(prev.Bounds)
+	}
+	met.Observe(DefaultBuckets)
+	if prev == nil {
+		return nil
+	}
+	if !met.Hist.SameBounds(prev) {
+		return ErrHistBounds
+	}
+	met.Hist.add(prev)
+	return nil
+}
+
+// ParseBuckets разбирает границы корзин вида "0.1,0.5,1".
+func ParseBuckets(str string) ([]float64, error) {
+	parts := strings.Split(str, ",")
+	bounds := make([]float64, 0, len(parts))
+	for _, p := range parts {
+		b, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, ErrInvalidHist
+		}
+		bounds = append(bounds, b)
+	}
+	if !increasing(bounds) {
+		return nil, ErrInvalidHist
+	}
+	return bounds, nil
+}
@@ -4,7 +4,9 @@ import (
 	ctx "context"
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,13 +16,23 @@ import (
 )
 
 const (
-	gauge   = "gauge"
-	counter = "counter"
+	gauge     = "gauge"
+	counter   = "counter"
+	histogram = "histogram"
 )
 
+// SnapshotPath путь, по которому агент в режиме pull отдает метрики серверу.
+const SnapshotPath = "/snapshot"
+
 var (
-	ErrInvalidVal  = errors.New("invalid metric value")
-	ErrInvalidType = errors.New("invalid metric type")
+	ErrInvalidVal    = errors.New("invalid metric value")
+	ErrInvalidType   = errors.New("invalid metric type")
+	ErrInvalidLabels = errors.New("invalid metric labels")
+	ErrInvalidHist   = errors.New("invalid histogram")
+	ErrHistBounds    = errors.New("histogram bounds differ from stored ones")
+
+	// DefaultBuckets границы корзин для гистограмм, созданных одиночным наблюдением.
+	DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
 
 	metricsPool = sync.Pool{ // Pool для переиспользования структур Metrics
 		New: func() any {
@@ -31,18 +43,24 @@ var (
 
 //go:generate ffjson $GOFILE
 type Metrics struct {
-	Delta *int64   `json:"delta,omitempty"`
-	Value *float64 `json:"value,omitempty"`
-	ID    string   `json:"id"`
-	MType string   `json:"type"`
+	Delta     *int64            `json:"delta,omitempty"`
+	Value     *float64          `json:"value,omitempty"`
+	Hist      *Histogram        `json:"histogram,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	ID        string            `json:"id"`
+	MType     string            `json:"type"`
+	Timestamp int64             `json:"timestamp,omitempty"` // unix milliseconds
 }
 
 func NewMetric(mtype, id string, val string) (*Metrics, error) {
 	met, _ := metricsPool.Get().(*Metrics)
 	met.ID = id
 	met.MType = mtype
+	met.Hist = nil
+	met.Labels = nil
+	met.Timestamp = 0
 
-	if !met.IsCounter() && !met.IsGauge() {
+	if !met.IsCounter() && !met.IsGauge() && !met.IsHistogram() {
 		metricsPool.Put(met)
 		return nil, ErrInvalidType
 	}
@@ -54,6 +72,8 @@ func NewMetric(mtype, id string, val string) (*Metrics, error) {
 	if met.IsCounter() {
 		err = met.setCounterValue(val)
 	} else {
+		// для гистограммы значение — одиночное наблюдение,
+		// которое раскладывается по корзинам при слиянии
 		err = met.setGaugeValue(val)
 	}
 	if err != nil {
@@ -85,6 +105,9 @@ func (met *Metrics) setGaugeValue(val string) error {
 func BuildMetric(name string, val any) *Metrics {
 	met, _ := metricsPool.Get().(*Metrics)
 	met.ID = name
+	met.Hist = nil
+	met.Labels = nil
+	met.Timestamp = 0
 
 	switch v := val.(type) {
 	case float64:
@@ -102,18 +125,73 @@ func BuildMetric(name string, val any) *Metrics {
 }
 
 func (met *Metrics) String() string {
+	name := met.ID + met.LabelString()
+	if met.Hist != nil {
+		return fmt.Sprintf(" (%s: count=%d sum=%g)", name, met.Hist.Count, met.Hist.Sum)
+	}
 	if met.Delta == nil && met.Value == nil {
-		return fmt.Sprintf(" (%s: <empty>)", met.ID)
+		return fmt.Sprintf(" (%s: <empty>)", name)
 	}
 	if met.IsCounter() {
-		return fmt.Sprintf(" (%s: %d)", met.ID, *met.Delta)
+		return fmt.Sprintf(" (%s: %d)", name, *met.Delta)
+	}
+	return fmt.Sprintf(" (%s: %g)", name, *met.Value)
+}
+
+// LabelString возвращает метки в виде {k1="v1",k2="v2"}, отсортированные по имени.
+// Для метрики без меток возвращается пустая строка.
+func (met *Metrics) LabelString() string {
+	if len(met.Labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(met.Labels))
+	for name := range met.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(met.Labels[name]))
 	}
-	return fmt.Sprintf(" (%s: %g)", met.ID, *met.Value)
+	b.WriteByte('}')
+	return b.String()
 }
 
-func (met *Metrics) MergeMetrics(met2 *Metrics) {
+// Key однозначно идентифицирует метрику по типу, имени и набору меток.
+func (met *Metrics) Key() string {
+	return met.MType + ":" + met.ID + met.LabelString()
+}
+
+// ParseLabels разбирает метки вида "k1=v1,k2=v2".
+func ParseLabels(str string) (map[string]string, error) {
+	if str == "" {
+		return nil, nil
+	}
+	pairs := strings.Split(str, ",")
+	labels := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		name, val, ok := strings.Cut(pair, "=")
+		if !ok || name == "" {
+			return nil, ErrInvalidLabels
+		}
+		labels[name] = val
+	}
+	return labels, nil
+}
+
+// MergeMetrics добавляет к метрике накопленное значение met2.
+func (met *Metrics) MergeMetrics(met2 *Metrics) error {
+	if met.IsHistogram() {
+		return met.mergeHistogram(met2)
+	}
 	if met2 == nil {
-		return
+		return nil
 	}
 	if met2.IsCounter() && met2.Delta != nil {
 		if met.Delta == nil {
@@ -121,13 +199,58 @@ func (met *Metrics) MergeMetrics(met2 *Metrics) {
 		}
 		*met.Delta += *met2.Delta
 	}
+	return nil
+}
+
+// Stamp присваивает метрике серверное время приема, если оно еще не задано:
+// заданным оно остается только у сэмплов Influx и восстановленных из файла.
+func (met *Metrics) Stamp(t time.Time) {
+	if met.Timestamp == 0 {
+		met.Timestamp = t.UnixMilli()
+	}
+}
+
+func (met *Metrics) Time() time.Time {
+	return time.UnixMilli(met.Timestamp)
+}
+
+// Validate проверяет согласованность корзин гистограммы.
+func (met *Metrics) Validate() error {
+	if met.IsHistogram() && met.Hist != nil && !met.Hist.valid() {
+		return ErrInvalidHist
+	}
+	return nil
+}
+
+// Copy возвращает копию метрики, значения не разделяются по указателям.
+// Метки и границы корзин считаются неизменяемыми и не копируются.
+func (met *Metrics) Copy() *Metrics {
+	cp := *met
+	if met.Hist != nil {
+		h := *met.Hist
+		h.Counts = append([]uint64(nil), met.Hist.Counts...)
+		cp.Hist = &h
+	}
+	if met.Delta != nil {
+		d := *met.Delta
+		cp.Delta = &d
+	}
+	if met.Value != nil {
+		v := *met.Value
+		cp.Value = &v
+	}
+	return &cp
 }
 
 func (met Metrics) ToSlice() []any {
+	labels := met.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
 	if met.IsCounter() {
-		return []any{met.ID, *met.Delta}
+		return []any{met.ID, *met.Delta, met.Time(), labels}
 	}
-	return []any{met.ID, *met.Value}
+	return []any{met.ID, *met.Value, met.Time(), labels}
 }
 
 func (met *Metrics) IsGauge() bool {
@@ -138,6 +261,10 @@ func (met *Metrics) IsCounter() bool {
 	return met.MType == counter
 }
 
+func (met *Metrics) IsHistogram() bool {
+	return met.MType == histogram
+}
+
 func Retry(cx ctx.Context, fn func() error) error {
 	log.Debug("Retry...")
 	expBackoff := backoff.NewExponentialBackOff()
@@ -5,6 +5,7 @@ package service
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	fflib "github.com/pquerna/ffjson/fflib/v1"
 )
@@ -33,11 +34,7 @@ func (j *Metrics) MarshalJSONBuf(buf fflib.EncodingBuffer) error {
 	var obj []byte
 	_ = obj
 	_ = err
-	buf.WriteString(`{ "id":`)
-	fflib.WriteJsonString(buf, string(j.ID))
-	buf.WriteString(`,"type":`)
-	fflib.WriteJsonString(buf, string(j.MType))
-	buf.WriteByte(',')
+	buf.WriteString(`{ `)
 	if j.Delta != nil {
 		if true {
 			buf.WriteString(`"delta":`)
@@ -52,6 +49,43 @@ func (j *Metrics) MarshalJSONBuf(buf fflib.EncodingBuffer) error {
 			buf.WriteByte(',')
 		}
 	}
+	if j.Hist != nil {
+		if true {
+			/* Struct fall back. type=service.Histogram kind=struct */
+			buf.WriteString(`"histogram":`)
+			err = buf.Encode(j.Hist)
+			if err != nil {
+				return err
+			}
+			buf.WriteByte(',')
+		}
+	}
+	if len(j.Labels) != 0 {
+		if j.Labels == nil {
+			buf.WriteString(`"labels":null`)
+		} else {
+			buf.WriteString(`"labels":{ `)
+			for key, value := range j.Labels {
+				fflib.WriteJsonString(buf, key)
+				buf.WriteString(`:`)
+				fflib.WriteJsonString(buf, string(value))
+				buf.WriteByte(',')
+			}
+			buf.Rewind(1)
+			buf.WriteByte('}')
+		}
+		buf.WriteByte(',')
+	}
+	buf.WriteString(`"id":`)
+	fflib.WriteJsonString(buf, string(j.ID))
+	buf.WriteString(`,"type":`)
+	fflib.WriteJsonString(buf, string(j.MType))
+	buf.WriteByte(',')
+	if j.Timestamp != 0 {
+		buf.WriteString(`"timestamp":`)
+		fflib.FormatBits2(buf, uint64(j.Timestamp), 10, j.Timestamp < 0)
+		buf.WriteByte(',')
+	}
 	buf.Rewind(1)
 	buf.WriteByte('}')
 	return nil
@@ -61,22 +95,34 @@ const (
 	ffjtMetricsbase = iota
 	ffjtMetricsnosuchkey
 
+	ffjtMetricsDelta
+
+	ffjtMetricsValue
+
+	ffjtMetricsHist
+
+	ffjtMetricsLabels
+
 	ffjtMetricsID
 
 	ffjtMetricsMType
 
-	ffjtMetricsDelta
-
-	ffjtMetricsValue
+	ffjtMetricsTimestamp
 )
 
+var ffjKeyMetricsDelta = []byte("delta")
+
+var ffjKeyMetricsValue = []byte("value")
+
+var ffjKeyMetricsHist = []byte("histogram")
+
+var ffjKeyMetricsLabels = []byte("labels")
+
 var ffjKeyMetricsID = []byte("id")
 
 var ffjKeyMetricsMType = []byte("type")
 
-var ffjKeyMetricsDelta = []byte("delta")
-
-var ffjKeyMetricsValue = []byte("value")
+var ffjKeyMetricsTimestamp = []byte("timestamp")
 
 // UnmarshalJSON umarshall json - template of ffjson
 func (j *Metrics) UnmarshalJSON(input []byte) error {
@@ -147,6 +193,14 @@ mainparse:
 						goto mainparse
 					}
 
+				case 'h':
+
+					if bytes.Equal(ffjKeyMetricsHist, kn) {
+						currentKey = ffjtMetricsHist
+						state = fflib.FFParse_want_colon
+						goto mainparse
+					}
+
 				case 'i':
 
 					if bytes.Equal(ffjKeyMetricsID, kn) {
@@ -155,12 +209,25 @@ mainparse:
 						goto mainparse
 					}
 
+				case 'l':
+
+					if bytes.Equal(ffjKeyMetricsLabels, kn) {
+						currentKey = ffjtMetricsLabels
+						state = fflib.FFParse_want_colon
+						goto mainparse
+					}
+
 				case 't':
 
 					if bytes.Equal(ffjKeyMetricsMType, kn) {
 						currentKey = ffjtMetricsMType
 						state = fflib.FFParse_want_colon
 						goto mainparse
+
+					} else if bytes.Equal(ffjKeyMetricsTimestamp, kn) {
+						currentKey = ffjtMetricsTimestamp
+						state = fflib.FFParse_want_colon
+						goto mainparse
 					}
 
 				case 'v':
@@ -173,14 +240,8 @@ mainparse:
 
 				}
 
-				if fflib.SimpleLetterEqualFold(ffjKeyMetricsValue, kn) {
-					currentKey = ffjtMetricsValue
-					state = fflib.FFParse_want_colon
-					goto mainparse
-				}
-
-				if fflib.SimpleLetterEqualFold(ffjKeyMetricsDelta, kn) {
-					currentKey = ffjtMetricsDelta
+				if fflib.EqualFoldRight(ffjKeyMetricsTimestamp, kn) {
+					currentKey = ffjtMetricsTimestamp
 					state = fflib.FFParse_want_colon
 					goto mainparse
 				}
@@ -197,6 +258,30 @@ mainparse:
 					goto mainparse
 				}
 
+				if fflib.EqualFoldRight(ffjKeyMetricsLabels, kn) {
+					currentKey = ffjtMetricsLabels
+					state = fflib.FFParse_want_colon
+					goto mainparse
+				}
+
+				if fflib.EqualFoldRight(ffjKeyMetricsHist, kn) {
+					currentKey = ffjtMetricsHist
+					state = fflib.FFParse_want_colon
+					goto mainparse
+				}
+
+				if fflib.SimpleLetterEqualFold(ffjKeyMetricsValue, kn) {
+					currentKey = ffjtMetricsValue
+					state = fflib.FFParse_want_colon
+					goto mainparse
+				}
+
+				if fflib.SimpleLetterEqualFold(ffjKeyMetricsDelta, kn) {
+					currentKey = ffjtMetricsDelta
+					state = fflib.FFParse_want_colon
+					goto mainparse
+				}
+
 				currentKey = ffjtMetricsnosuchkey
 				state = fflib.FFParse_want_colon
 				goto mainparse
@@ -214,17 +299,26 @@ mainparse:
 			if tok == fflib.FFTok_left_brace || tok == fflib.FFTok_left_bracket || tok == fflib.FFTok_integer || tok == fflib.FFTok_double || tok == fflib.FFTok_string || tok == fflib.FFTok_bool || tok == fflib.FFTok_null {
 				switch currentKey {
 
+				case ffjtMetricsDelta:
+					goto handle_Delta
+
+				case ffjtMetricsValue:
+					goto handle_Value
+
+				case ffjtMetricsHist:
+					goto handle_Hist
+
+				case ffjtMetricsLabels:
+					goto handle_Labels
+
 				case ffjtMetricsID:
 					goto handle_ID
 
 				case ffjtMetricsMType:
 					goto handle_MType
 
-				case ffjtMetricsDelta:
-					goto handle_Delta
-
-				case ffjtMetricsValue:
-					goto handle_Value
+				case ffjtMetricsTimestamp:
+					goto handle_Timestamp
 
 				case ffjtMetricsnosuchkey:
 					err = fs.SkipField(tok)
@@ -240,25 +334,65 @@ mainparse:
 		}
 	}
 
-handle_ID:
+handle_Delta:
 
-	/* handler: j.ID type=string kind=string quoted=false*/
+	/* handler: j.Delta type=int64 kind=int64 quoted=false*/
 
 	{
+		if tok != fflib.FFTok_integer && tok != fflib.FFTok_null {
+			return fs.WrapErr(fmt.Errorf("cannot unmarshal %s into Go value for int64", tok))
+		}
+	}
 
-		{
-			if tok != fflib.FFTok_string && tok != fflib.FFTok_null {
-				return fs.WrapErr(fmt.Errorf("cannot unmarshal %s into Go value for string", tok))
+	{
+
+		if tok == fflib.FFTok_null {
+
+			j.Delta = nil
+
+		} else {
+
+			tval, err := fflib.ParseInt(fs.Output.Bytes(), 10, 64)
+
+			if err != nil {
+				return fs.WrapErr(err)
 			}
+
+			ttypval := int64(tval)
+			j.Delta = &ttypval
+
+		}
+	}
+
+	state = fflib.FFParse_after_value
+	goto mainparse
+
+handle_Value:
+
+	/* handler: j.Value type=float64 kind=float64 quoted=false*/
+
+	{
+		if tok != fflib.FFTok_double && tok != fflib.FFTok_integer && tok != fflib.FFTok_null {
+			return fs.WrapErr(fmt.Errorf("cannot unmarshal %s into Go value for float64", tok))
 		}
+	}
+
+	{
 
 		if tok == fflib.FFTok_null {
 
+			j.Value = nil
+
 		} else {
 
-			outBuf := fs.Output.Bytes()
+			tval, err := fflib.ParseFloat(fs.Output.Bytes(), 64)
 
-			j.ID = string(string(outBuf))
+			if err != nil {
+				return fs.WrapErr(err)
+			}
+
+			ttypval := float64(tval)
+			j.Value = &ttypval
 
 		}
 	}
@@ -266,9 +400,134 @@ handle_ID:
 	state = fflib.FFParse_after_value
 	goto mainparse
 
-handle_MType:
+handle_Hist:
 
-	/* handler: j.MType type=string kind=string quoted=false*/
+	/* handler: j.Hist type=service.Histogram kind=struct quoted=false*/
+
+	{
+		/* Falling back. type=service.Histogram kind=struct */
+		tbuf, err := fs.CaptureField(tok)
+		if err != nil {
+			return fs.WrapErr(err)
+		}
+
+		err = json.Unmarshal(tbuf, &j.Hist)
+		if err != nil {
+			return fs.WrapErr(err)
+		}
+	}
+
+	state = fflib.FFParse_after_value
+	goto mainparse
+
+handle_Labels:
+
+	/* handler: j.Labels type=map[string]string kind=map quoted=false*/
+
+	{
+
+		{
+			if tok != fflib.FFTok_left_bracket && tok != fflib.FFTok_null {
+				return fs.WrapErr(fmt.Errorf("cannot unmarshal %s into Go value for ", tok))
+			}
+		}
+
+		if tok == fflib.FFTok_null {
+			j.Labels = nil
+		} else {
+
+			j.Labels = make(map[string]string, 0)
+
+			wantVal := true
+
+			for {
+
+				var k string
+
+				var tmpJLabels string
+
+				tok = fs.Scan()
+				if tok == fflib.FFTok_error {
+					goto tokerror
+				}
+				if tok == fflib.FFTok_right_bracket {
+					break
+				}
+
+				if tok == fflib.FFTok_comma {
+					if wantVal == true {
+						// TODO(pquerna): this isn't an ideal error message, this handles
+						// things like [,,,] as an array value.
+						return fs.WrapErr(fmt.Errorf("wanted value token, but got token: %v", tok))
+					}
+					continue
+				} else {
+					wantVal = true
+				}
+
+				/* handler: k type=string kind=string quoted=false*/
+
+				{
+
+					{
+						if tok != fflib.FFTok_string && tok != fflib.FFTok_null {
+							return fs.WrapErr(fmt.Errorf("cannot unmarshal %s into Go value for string", tok))
+						}
+					}
+
+					if tok == fflib.FFTok_null {
+
+					} else {
+
+						outBuf := fs.Output.Bytes()
+
+						k = string(string(outBuf))
+
+					}
+				}
+
+				// Expect ':' after key
+				tok = fs.Scan()
+				if tok != fflib.FFTok_colon {
+					return fs.WrapErr(fmt.Errorf("wanted colon token, but got token: %v", tok))
+				}
+
+				tok = fs.Scan()
+				/* handler: tmpJLabels type=string kind=string quoted=false*/
+
+				{
+
+					{
+						if tok != fflib.FFTok_string && tok != fflib.FFTok_null {
+							return fs.WrapErr(fmt.Errorf("cannot unmarshal %s into Go value for string", tok))
+						}
+					}
+
+					if tok == fflib.FFTok_null {
+
+					} else {
+
+						outBuf := fs.Output.Bytes()
+
+						tmpJLabels = string(string(outBuf))
+
+					}
+				}
+
+				j.Labels[k] = tmpJLabels
+
+				wantVal = false
+			}
+
+		}
+	}
+
+	state = fflib.FFParse_after_value
+	goto mainparse
+
+handle_ID:
+
+	/* handler: j.ID type=string kind=string quoted=false*/
 
 	{
 
@@ -284,7 +543,7 @@ handle_MType:
 
 			outBuf := fs.Output.Bytes()
 
-			j.MType = string(string(outBuf))
+			j.ID = string(string(outBuf))
 
 		}
 	}
@@ -292,32 +551,25 @@ handle_MType:
 	state = fflib.FFParse_after_value
 	goto mainparse
 
-handle_Delta:
+handle_MType:
 
-	/* handler: j.Delta type=int64 kind=int64 quoted=false*/
+	/* handler: j.MType type=string kind=string quoted=false*/
 
 	{
-		if tok != fflib.FFTok_integer && tok != fflib.FFTok_null {
-			return fs.WrapErr(fmt.Errorf("cannot unmarshal %s into Go value for int64", tok))
-		}
-	}
 
-	{
+		{
+			if tok != fflib.FFTok_string && tok != fflib.FFTok_null {
+				return fs.WrapErr(fmt.Errorf("cannot unmarshal %s into Go value for string", tok))
+			}
+		}
 
 		if tok == fflib.FFTok_null {
 
-			j.Delta = nil
-
 		} else {
 
-			tval, err := fflib.ParseInt(fs.Output.Bytes(), 10, 64)
-
-			if err != nil {
-				return fs.WrapErr(err)
-			}
+			outBuf := fs.Output.Bytes()
 
-			ttypval := int64(tval)
-			j.Delta = &ttypval
+			j.MType = string(string(outBuf))
 
 		}
 	}
@@ -325,13 +577,13 @@ handle_Delta:
 	state = fflib.FFParse_after_value
 	goto mainparse
 
-handle_Value:
+handle_Timestamp:
 
-	/* handler: j.Value type=float64 kind=float64 quoted=false*/
+	/* handler: j.Timestamp type=int64 kind=int64 quoted=false*/
 
 	{
-		if tok != fflib.FFTok_double && tok != fflib.FFTok_integer && tok != fflib.FFTok_null {
-			return fs.WrapErr(fmt.Errorf("cannot unmarshal %s into Go value for float64", tok))
+		if tok != fflib.FFTok_integer && tok != fflib.FFTok_null {
+			return fs.WrapErr(fmt.Errorf("cannot unmarshal %s into Go value for int64", tok))
 		}
 	}
 
@@ -339,18 +591,15 @@ handle_Value:
 
 		if tok == fflib.FFTok_null {
 
-			j.Value = nil
-
 		} else {
 
-			tval, err := fflib.ParseFloat(fs.Output.Bytes(), 64)
+			tval, err := fflib.ParseInt(fs.Output.Bytes(), 10, 64)
 
 			if err != nil {
 				return fs.WrapErr(err)
 			}
 
-			ttypval := float64(tval)
-			j.Value = &ttypval
+			j.Timestamp = int64(tval)
 
 		}
 	}
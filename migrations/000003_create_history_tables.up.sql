@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS gauge_history(
+   id VARCHAR(255) NOT NULL,
+   value DOUBLE PRECISION NOT NULL,
+   created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS gauge_history_id_created_at_idx ON gauge_history(id, created_at);
+
+CREATE TABLE IF NOT EXISTS counter_history(
+   id VARCHAR(255) NOT NULL,
+   value BIGINT NOT NULL,
+   created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS counter_history_id_created_at_idx ON counter_history(id, created_at);
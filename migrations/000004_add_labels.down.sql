@@ -0,0 +1,17 @@
+DROP INDEX IF EXISTS counter_history_id_labels_created_at_idx;
+ALTER TABLE counter_history DROP COLUMN labels;
+CREATE INDEX IF NOT EXISTS counter_history_id_created_at_idx ON counter_history(id, created_at);
+
+DROP INDEX IF EXISTS gauge_history_id_labels_created_at_idx;
+ALTER TABLE gauge_history DROP COLUMN labels;
+CREATE INDEX IF NOT EXISTS gauge_history_id_created_at_idx ON gauge_history(id, created_at);
+
+DELETE FROM counter WHERE labels <> '{}';
+ALTER TABLE counter DROP CONSTRAINT counter_pkey;
+ALTER TABLE counter DROP COLUMN labels;
+ALTER TABLE counter ADD PRIMARY KEY (id);
+
+DELETE FROM gauge WHERE labels <> '{}';
+ALTER TABLE gauge DROP CONSTRAINT gauge_pkey;
+ALTER TABLE gauge DROP COLUMN labels;
+ALTER TABLE gauge ADD PRIMARY KEY (id);
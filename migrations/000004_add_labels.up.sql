@@ -0,0 +1,15 @@
+ALTER TABLE gauge ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE gauge DROP CONSTRAINT IF EXISTS gauge_pkey;
+ALTER TABLE gauge ADD PRIMARY KEY (id, labels);
+
+ALTER TABLE counter ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE counter DROP CONSTRAINT IF EXISTS counter_pkey;
+ALTER TABLE counter ADD PRIMARY KEY (id, labels);
+
+ALTER TABLE gauge_history ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}';
+DROP INDEX IF EXISTS gauge_history_id_created_at_idx;
+CREATE INDEX IF NOT EXISTS gauge_history_id_labels_created_at_idx ON gauge_history(id, labels, created_at);
+
+ALTER TABLE counter_history ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}';
+DROP INDEX IF EXISTS counter_history_id_created_at_idx;
+CREATE INDEX IF NOT EXISTS counter_history_id_labels_created_at_idx ON counter_history(id, labels, created_at);
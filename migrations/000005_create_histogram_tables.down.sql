@@ -0,0 +1,2 @@
+DROP TABLE histogram_history;
+DROP TABLE histogram;
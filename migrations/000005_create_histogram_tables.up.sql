@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS histogram(
+   id VARCHAR(255) NOT NULL,
+   labels JSONB NOT NULL DEFAULT '{}',
+   bounds DOUBLE PRECISION[] NOT NULL,
+   counts BIGINT[] NOT NULL,
+   sum DOUBLE PRECISION NOT NULL,
+   count BIGINT NOT NULL,
+   PRIMARY KEY (id, labels)
+);
+
+CREATE TABLE IF NOT EXISTS histogram_history(
+   id VARCHAR(255) NOT NULL,
+   labels JSONB NOT NULL DEFAULT '{}',
+   bounds DOUBLE PRECISION[] NOT NULL,
+   counts BIGINT[] NOT NULL,
+   sum DOUBLE PRECISION NOT NULL,
+   count BIGINT NOT NULL,
+   created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS histogram_history_id_labels_created_at_idx ON histogram_history(id, labels, created_at);
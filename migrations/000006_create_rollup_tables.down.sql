@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS histogram_history_created_at_idx;
+DROP INDEX IF EXISTS counter_history_created_at_idx;
+DROP INDEX IF EXISTS gauge_history_created_at_idx;
+DROP TABLE rollup_state;
+DROP TABLE histogram_rollup_1h;
+DROP TABLE histogram_rollup_1m;
+DROP TABLE rollup_1h;
+DROP TABLE rollup_1m;
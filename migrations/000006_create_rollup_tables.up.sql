@@ -0,0 +1,62 @@
+CREATE TABLE IF NOT EXISTS rollup_1m(
+   type VARCHAR(16) NOT NULL,
+   id VARCHAR(255) NOT NULL,
+   labels JSONB NOT NULL DEFAULT '{}',
+   bucket TIMESTAMPTZ NOT NULL,
+   min DOUBLE PRECISION NOT NULL,
+   max DOUBLE PRECISION NOT NULL,
+   avg DOUBLE PRECISION NOT NULL,
+   last DOUBLE PRECISION NOT NULL,
+   count BIGINT NOT NULL,
+   sum DOUBLE PRECISION,
+   PRIMARY KEY (type, id, labels, bucket)
+);
+CREATE INDEX IF NOT EXISTS rollup_1m_bucket_idx ON rollup_1m(bucket);
+
+CREATE TABLE IF NOT EXISTS rollup_1h(
+   type VARCHAR(16) NOT NULL,
+   id VARCHAR(255) NOT NULL,
+   labels JSONB NOT NULL DEFAULT '{}',
+   bucket TIMESTAMPTZ NOT NULL,
+   min DOUBLE PRECISION NOT NULL,
+   max DOUBLE PRECISION NOT NULL,
+   avg DOUBLE PRECISION NOT NULL,
+   last DOUBLE PRECISION NOT NULL,
+   count BIGINT NOT NULL,
+   sum DOUBLE PRECISION,
+   PRIMARY KEY (type, id, labels, bucket)
+);
+CREATE INDEX IF NOT EXISTS rollup_1h_bucket_idx ON rollup_1h(bucket);
+
+CREATE TABLE IF NOT EXISTS histogram_rollup_1m(
+   id VARCHAR(255) NOT NULL,
+   labels JSONB NOT NULL DEFAULT '{}',
+   bucket TIMESTAMPTZ NOT NULL,
+   bounds DOUBLE PRECISION[] NOT NULL,
+   counts BIGINT[] NOT NULL,
+   sum DOUBLE PRECISION NOT NULL,
+   count BIGINT NOT NULL,
+   PRIMARY KEY (id, labels, bucket)
+);
+CREATE INDEX IF NOT EXISTS histogram_rollup_1m_bucket_idx ON histogram_rollup_1m(bucket);
+
+CREATE TABLE IF NOT EXISTS histogram_rollup_1h(
+   id VARCHAR(255) NOT NULL,
+   labels JSONB NOT NULL DEFAULT '{}',
+   bucket TIMESTAMPTZ NOT NULL,
+   bounds DOUBLE PRECISION[] NOT NULL,
+   counts BIGINT[] NOT NULL,
+   sum DOUBLE PRECISION NOT NULL,
+   count BIGINT NOT NULL,
+   PRIMARY KEY (id, labels, bucket)
+);
+CREATE INDEX IF NOT EXISTS histogram_rollup_1h_bucket_idx ON histogram_rollup_1h(bucket);
+
+CREATE TABLE IF NOT EXISTS rollup_state(
+   resolution VARCHAR(8) PRIMARY KEY,
+   rolled_until TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS gauge_history_created_at_idx ON gauge_history(created_at);
+CREATE INDEX IF NOT EXISTS counter_history_created_at_idx ON counter_history(created_at);
+CREATE INDEX IF NOT EXISTS histogram_history_created_at_idx ON histogram_history(created_at);
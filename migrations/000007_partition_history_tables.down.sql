@@ -0,0 +1,39 @@
+CREATE TABLE gauge_history_plain(
+   id VARCHAR(255) NOT NULL,
+   value DOUBLE PRECISION NOT NULL,
+   created_at TIMESTAMPTZ NOT NULL,
+   labels JSONB NOT NULL DEFAULT '{}'
+);
+INSERT INTO gauge_history_plain SELECT id, value, created_at, labels FROM gauge_history;
+DROP TABLE gauge_history;
+ALTER TABLE gauge_history_plain RENAME TO gauge_history;
+CREATE INDEX IF NOT EXISTS gauge_history_id_labels_created_at_idx ON gauge_history(id, labels, created_at);
+CREATE INDEX IF NOT EXISTS gauge_history_created_at_idx ON gauge_history(created_at);
+
+CREATE TABLE counter_history_plain(
+   id VARCHAR(255) NOT NULL,
+   value BIGINT NOT NULL,
+   created_at TIMESTAMPTZ NOT NULL,
+   labels JSONB NOT NULL DEFAULT '{}'
+);
+INSERT INTO counter_history_plain SELECT id, value, created_at, labels FROM counter_history;
+DROP TABLE counter_history;
+ALTER TABLE counter_history_plain RENAME TO counter_history;
+CREATE INDEX IF NOT EXISTS counter_history_id_labels_created_at_idx ON counter_history(id, labels, created_at);
+CREATE INDEX IF NOT EXISTS counter_history_created_at_idx ON counter_history(created_at);
+
+CREATE TABLE histogram_history_plain(
+   id VARCHAR(255) NOT NULL,
+   labels JSONB NOT NULL DEFAULT '{}',
+   bounds DOUBLE PRECISION[] NOT NULL,
+   counts BIGINT[] NOT NULL,
+   sum DOUBLE PRECISION NOT NULL,
+   count BIGINT NOT NULL,
+   created_at TIMESTAMPTZ NOT NULL
+);
+INSERT INTO histogram_history_plain
+SELECT id, labels, bounds, counts, sum, count, created_at FROM histogram_history;
+DROP TABLE histogram_history;
+ALTER TABLE histogram_history_plain RENAME TO histogram_history;
+CREATE INDEX IF NOT EXISTS histogram_history_id_labels_created_at_idx ON histogram_history(id, labels, created_at);
+CREATE INDEX IF NOT EXISTS histogram_history_created_at_idx ON histogram_history(created_at);
@@ -0,0 +1,284 @@
+// Package client отправляет метрики приложения на сервер метрик.
+//
+// Значения агрегируются локально и раз в интервал уходят одним пакетом
+// на /updates/ (JSON, gzip, подпись HashSHA256 при заданном ключе):
+//
+//	cl := client.New("localhost:8080", client.WithKey("secret"))
+//	defer cl.Close()
+//	cl.Counter("Requests").Add(1)
+//	cl.Gauge("QueueLen").Set(12)
+//	cl.Histogram("Latency").Observe(0.042)
+package client
+
+import (
+	"bytes"
+	ctx "context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"metrics/internal/compress"
+	"metrics/internal/security"
+	s "metrics/internal/service"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/pquerna/ffjson/ffjson"
+)
+
+const (
+	DefaultInterval     = 10 * time.Second
+	DefaultCloseTimeout = 15 * time.Second
+)
+
+// ErrRejected сервер отклонил пакет (4xx): метрики пакета отброшены.
+var ErrRejected = errors.New("batch rejected by server")
+
+type Client struct {
+	httpClient   *http.Client
+	pending      map[string]*s.Metrics
+	labels       map[string]string
+	done         chan struct{}
+	onError      func(error)
+	url          string
+	key          string
+	wg           sync.WaitGroup
+	mtx          sync.Mutex
+	closeOnce    sync.Once
+	interval     time.Duration
+	closeTimeout time.Duration
+}
+
+type Option func(*Client)
+
+// WithKey ключ подписи HashSHA256, как у агента (-k).
+func WithKey(key string) Option {
+	return func(c *Client) { c.key = key }
+}
+
+// WithInterval период отправки накопленных значений.
+func WithInterval(d time.Duration) Option {
+	return func(c *Client) { c.interval = d }
+}
+
+// WithHTTPClient http-клиент, например, с настройками TLS.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithLabels метки, добавляемые ко всем метрикам клиента.
+func WithLabels(labels map[string]string) Option {
+	return func(c *Client) { c.labels = maps.Clone(labels) }
+}
+
+// WithErrorHandler получает ошибки фоновой отправки (по умолчанию игнорируются).
+func WithErrorHandler(fn func(error)) Option {
+	return func(c *Client) { c.onError = fn }
+}
+
+// WithCloseTimeout ограничивает время последней отправки в Close.
+func WithCloseTimeout(d time.Duration) Option {
+	return func(c *Client) { c.closeTimeout = d }
+}
+
+// New создает клиент и запускает фоновую отправку. address — host:port
+// или URL сервера (http://, https://).
+func New(address string, opts ...Option) *Client {
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	c := &Client{
+		httpClient:   http.DefaultClient,
+		pending:      make(map[string]*s.Metrics),
+		done:         make(chan struct{}),
+		onError:      func(error) {},
+		url:          strings.TrimSuffix(address, "/") + "/updates/",
+		interval:     DefaultInterval,
+		closeTimeout: DefaultCloseTimeout,
+	}
+	for _, op := range opts {
+		op(c)
+	}
+	c.wg.Add(1)
+	go c.flushLoop()
+	return c
+}
+
+type Counter struct {
+	c   *Client
+	met *s.Metrics
+}
+
+type Gauge struct {
+	c   *Client
+	met *s.Metrics
+}
+
+type Histogram struct {
+	c      *Client
+	met    *s.Metrics
+	bounds []float64
+}
+
+func (c *Client) newMetric(mtype, name string) *s.Metrics {
+	return &s.Metrics{ID: name, MType: mtype, Labels: c.labels}
+}
+
+func (c *Client) Counter(name string) *Counter {
+	return &Counter{c: c, met: c.newMetric("counter", name)}
+}
+
+func (c *Client) Gauge(name string) *Gauge {
+	return &Gauge{c: c, met: c.newMetric("gauge", name)}
+}
+
+// Histogram гистограмма с границами корзин bounds (по умолчанию service.DefaultBuckets).
+func (c *Client) Histogram(name string, bounds ...float64) *Histogram {
+	if len(bounds) == 0 {
+		bounds = s.DefaultBuckets
+	}
+	return &Histogram{c: c, met: c.newMetric("histogram", name), bounds: bounds}
+}
+
+func (cn *Counter) Add(n int64) {
+	cn.c.update(cn.met, func(met *s.Metrics) {
+		if met.Delta == nil {
+			met.Delta = new(int64)
+		}
+		*met.Delta += n
+	})
+}
+
+func (g *Gauge) Set(v float64) {
+	g.c.update(g.met, func(met *s.Metrics) { met.Value = &v })
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.c.update(h.met, func(met *s.Metrics) {
+		if met.Hist == nil {
+			met.Hist = s.NewHistogram(h.bounds)
+		}
+		met.Hist.Observe(v)
+	})
+}
+
+// update меняет накопленное значение метрики, создавая его из шаблона.
+func (c *Client) update(tmpl *s.Metrics, fn func(*s.Metrics)) {
+	key := tmpl.Key()
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	met, ok := c.pending[key]
+	if !ok {
+		met = &s.Metrics{ID: tmpl.ID, MType: tmpl.MType, Labels: tmpl.Labels}
+		c.pending[key] = met
+	}
+	fn(met)
+}
+
+// Flush отправляет накопленные значения. При сетевой ошибке или ответе 5xx
+// значения возвращаются в накопитель и уйдут со следующей отправкой.
+func (c *Client) Flush(cx ctx.Context) error {
+	c.mtx.Lock()
+	batch := c.pending
+	c.pending = make(map[string]*s.Metrics)
+	c.mtx.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+	metrics := make([]*s.Metrics, 0, len(batch))
+	for _, met := range batch {
+		metrics = append(metrics, met)
+	}
+	err := c.post(cx, metrics)
+	if err != nil && !errors.Is(err, ErrRejected) {
+		c.restore(batch)
+	}
+	return err
+}
+
+// restore возвращает неотправленные значения. Новое значение gauge
+// важнее старого, счетчики и гистограммы складываются.
+func (c *Client) restore(batch map[string]*s.Metrics) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for key, met := range batch {
+		cur, ok := c.pending[key]
+		switch {
+		case !ok:
+			c.pending[key] = met
+		case !cur.IsGauge():
+			_ = cur.MergeMetrics(met) // границы корзин у значений одной метрики совпадают
+		}
+	}
+}
+
+func (c *Client) post(cx ctx.Context, metrics []*s.Metrics) error {
+	data, err := ffjson.Marshal(metrics)
+	if err != nil {
+		return fmt.Errorf("marshal batch: %w", err)
+	}
+	body, err := compress.Compress(data)
+	if err != nil {
+		return fmt.Errorf("compress batch: %w", err)
+	}
+	req, err := http.NewRequestWithContext(cx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	if c.key != "" {
+		req.Header.Set("HashSHA256", security.Hash(&data, c.key))
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("post batch: %w", err)
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return fmt.Errorf("post batch: status %d", resp.StatusCode)
+	case resp.StatusCode >= http.StatusBadRequest:
+		return fmt.Errorf("%w: status %d", ErrRejected, resp.StatusCode)
+	}
+	return nil
+}
+
+func (c *Client) flushLoop() {
+	defer c.wg.Done()
+	tick := time.NewTicker(c.interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			if err := c.Flush(ctx.Background()); err != nil {
+				c.onError(err)
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Close останавливает фоновую отправку и отправляет остаток,
+// повторяя попытки не дольше WithCloseTimeout.
+func (c *Client) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.wg.Wait()
+		cx, cancel := ctx.WithTimeout(ctx.Background(), c.closeTimeout)
+		defer cancel()
+		err = s.Retry(cx, func() error {
+			flushErr := c.Flush(cx)
+			if errors.Is(flushErr, ErrRejected) {
+				return backoff.Permanent(flushErr)
+			}
+			return flushErr
+		})
+	})
+	return err
+}
@@ -0,0 +1,129 @@
+package client
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"metrics/internal/security"
+	s "metrics/internal/service"
+
+	"github.com/pquerna/ffjson/ffjson"
+)
+
+type fakeServer struct {
+	mtx     sync.Mutex
+	status  int
+	batches [][]*s.Metrics
+}
+
+func (fs *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	zr, err := gzip.NewReader(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	data, _ := io.ReadAll(zr)
+	if r.Header.Get("HashSHA256") != security.Hash(&data, "secret") {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+	if fs.status != 0 {
+		w.WriteHeader(fs.status)
+		return
+	}
+	var batch []*s.Metrics
+	_ = ffjson.Unmarshal(data, &batch)
+	fs.batches = append(fs.batches, batch)
+}
+
+func find(batch []*s.Metrics, id string) *s.Metrics {
+	for _, met := range batch {
+		if met.ID == id {
+			return met
+		}
+	}
+	return nil
+}
+
+func TestClientAggregatesAndFlushes(t *testing.T) {
+	fs := &fakeServer{}
+	serv := httptest.NewServer(fs)
+	defer serv.Close()
+
+	cl := New(serv.URL, WithKey("secret"), WithInterval(time.Hour), WithLabels(map[string]string{"app": "api"}))
+	requests := cl.Counter("Requests")
+	requests.Add(2)
+	requests.Add(3)
+	cl.Gauge("QueueLen").Set(7)
+	cl.Gauge("QueueLen").Set(4)
+	latency := cl.Histogram("Latency", 0.1, 1)
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	if err := cl.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fs.batches) != 1 || len(fs.batches[0]) != 3 {
+		t.Fatalf("expected one batch of 3 metrics, got %v", fs.batches)
+	}
+	batch := fs.batches[0]
+	if met := find(batch, "Requests"); met == nil || *met.Delta != 5 || met.Labels["app"] != "api" {
+		t.Errorf("expected Requests{app=api} 5, got %v", met)
+	}
+	if met := find(batch, "QueueLen"); met == nil || *met.Value != 4 {
+		t.Errorf("expected QueueLen 4, got %v", met)
+	}
+	if met := find(batch, "Latency"); met == nil || met.Hist == nil || met.Hist.Count != 2 || met.Hist.Counts[0] != 1 {
+		t.Errorf("expected Latency with 2 observations, got %v", met)
+	}
+}
+
+func TestClientKeepsUnsentValues(t *testing.T) {
+	fs := &fakeServer{status: http.StatusServiceUnavailable}
+	serv := httptest.NewServer(fs)
+	defer serv.Close()
+
+	cl := New(serv.URL, WithKey("secret"), WithInterval(time.Hour))
+	defer cl.Close()
+	cl.Counter("Requests").Add(2)
+	cl.Gauge("QueueLen").Set(1)
+	if err := cl.Flush(context.Background()); err == nil {
+		t.Fatal("expected flush error")
+	}
+	cl.Counter("Requests").Add(3)
+	cl.Gauge("QueueLen").Set(9)
+
+	fs.mtx.Lock()
+	fs.status = 0
+	fs.mtx.Unlock()
+	if err := cl.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	batch := fs.batches[0]
+	if met := find(batch, "Requests"); met == nil || *met.Delta != 5 {
+		t.Errorf("expected Requests 5 after retry, got %v", met)
+	}
+	if met := find(batch, "QueueLen"); met == nil || *met.Value != 9 {
+		t.Errorf("expected newest QueueLen 9, got %v", met)
+	}
+
+	// отклоненный пакет не возвращается в накопитель
+	fs.mtx.Lock()
+	fs.status = http.StatusBadRequest
+	fs.mtx.Unlock()
+	cl.Counter("Requests").Add(1)
+	if err := cl.Flush(context.Background()); err == nil {
+		t.Fatal("expected rejection")
+	}
+	if len(cl.pending) != 0 {
+		t.Errorf("expected rejected batch to be dropped, got %v", cl.pending)
+	}
+}